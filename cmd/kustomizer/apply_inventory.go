@@ -69,6 +69,7 @@ type applyInventoryFlags struct {
 	source          string
 	revision        string
 	createNamespace bool
+	recordDigests   bool
 	ageIdentities   string
 }
 
@@ -89,6 +90,8 @@ func init() {
 	applyInventoryCmd.Flags().StringVar(&applyInventoryArgs.source, "source", "", "The URL to the source code.")
 	applyInventoryCmd.Flags().StringVar(&applyInventoryArgs.revision, "revision", "", "The revision identifier.")
 	applyInventoryCmd.Flags().BoolVar(&applyInventoryArgs.createNamespace, "create-namespace", false, "Create the inventory namespace if not present.")
+	applyInventoryCmd.Flags().BoolVar(&applyInventoryArgs.recordDigests, "record-digests", false,
+		"Record in the inventory the digest of the fields applied to each object, the objects are read back after they are applied.")
 	applyInventoryCmd.Flags().StringVar(&applyInventoryArgs.ageIdentities, "age-identities", "",
 		"Path to a file containing one or more age identities (private keys generated by age-keygen).")
 
@@ -140,6 +143,7 @@ func runApplyInventoryCmd(cmd *cobra.Command, args []string) error {
 	invStorage := &inventory.Storage{
 		Manager: resMgr,
 		Owner:   inventoryOwner,
+		Version: VERSION,
 	}
 
 	// contains only CRDs and Namespaces
@@ -215,12 +219,20 @@ func runApplyInventoryCmd(cmd *cobra.Command, args []string) error {
 		logger.Println(change.String())
 	}
 
-	staleObjects, err := invStorage.GetInventoryStaleObjects(ctx, newInventory)
+	staleObjects, err := invStorage.GetInventoryStaleObjects(ctx, newInventory, inventory.PruneOptions{})
 	if err != nil {
 		return fmt.Errorf("inventory query failed, error: %w", err)
 	}
 
-	err = invStorage.ApplyInventory(ctx, newInventory, applyInventoryArgs.createNamespace)
+	if applyInventoryArgs.recordDigests {
+		if err := invStorage.RecordObjectDigests(ctx, newInventory, objects); err != nil {
+			return fmt.Errorf("inventory digests failed, error: %w", err)
+		}
+	}
+
+	_, err = invStorage.ApplyInventory(ctx, newInventory, inventory.ApplyOptions{
+		CreateNamespace: applyInventoryArgs.createNamespace,
+	})
 	if err != nil {
 		return fmt.Errorf("inventory apply failed, error: %w", err)
 	}
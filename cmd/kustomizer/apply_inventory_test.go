@@ -28,6 +28,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	. "github.com/onsi/gomega"
+
+	"github.com/stefanprodan/kustomizer/pkg/inventory"
 )
 
 func TestApply(t *testing.T) {
@@ -122,6 +124,24 @@ func TestApply(t *testing.T) {
 		g.Expect(output).To(MatchRegexp("waiting"))
 	})
 
+	t.Run("records digests", func(t *testing.T) {
+		_, err := executeCommand(fmt.Sprintf(
+			"apply inv %s -k %s -n %s --record-digests",
+			id,
+			dir,
+			id,
+		))
+		g.Expect(err).NotTo(HaveOccurred())
+
+		inv := inventory.NewInventory(id, id)
+		err = newTestInventoryStorage().GetInventory(context.Background(), inv)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(inv.Resources).NotTo(BeEmpty())
+		for _, entry := range inv.Resources {
+			g.Expect(entry.Digest).NotTo(BeEmpty())
+		}
+	})
+
 	t.Run("recreates immutable objects", func(t *testing.T) {
 		dir, err := makeTestDir(id, testManifests(id, id, true))
 		g.Expect(err).NotTo(HaveOccurred())
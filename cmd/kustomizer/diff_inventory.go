@@ -178,7 +178,7 @@ func runDiffInventoryCmd(cmd *cobra.Command, args []string) error {
 	}
 
 	if !invalid {
-		staleObjects, err := invStorage.GetInventoryStaleObjects(ctx, newInventory)
+		staleObjects, err := invStorage.GetInventoryStaleObjects(ctx, newInventory, inventory.PruneOptions{})
 		if err != nil {
 			return fmt.Errorf("inventory query failed, error: %w", err)
 		}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/stefanprodan/kustomizer/pkg/inventory"
+)
+
+// newTestInventoryStorage returns an inventory storage backed by the envtest API server,
+// for the tests that depend on the server-side apply semantics.
+func newTestInventoryStorage() *inventory.Storage {
+	return &inventory.Storage{
+		Manager: ssa.NewResourceManager(envTestClient, nil, inventoryOwner),
+		Owner:   inventoryOwner,
+	}
+}
+
+func TestInventoryStorage_ClearSource(t *testing.T) {
+	g := NewWithT(t)
+	id := "storage-" + randStringRunes(5)
+	ctx := context.Background()
+
+	err := createNamespace(id)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	s := newTestInventoryStorage()
+	inv := inventory.NewInventory(id, id)
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// another field manager takes over the source annotation, e.g. 'kubectl annotate --overwrite'
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).NotTo(HaveOccurred())
+	patch := []byte(`{"metadata":{"annotations":{"` + inventoryOwner.Group + `/source":"oci://registry/other"}}}`)
+	err = envTestClient.Patch(ctx, cm, client.RawPatch(types.MergePatchType, patch), client.FieldOwner("kubectl-annotate"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	inv = inventory.NewInventory(id, id)
+	_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	cm, err = s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cm.GetAnnotations()).ToNot(HaveKey(inventoryOwner.Group + "/source"))
+	g.Expect(cm.GetAnnotations()).ToNot(HaveKey(inventoryOwner.Group + "/revision"))
+}
+
+func TestInventoryStorage_StrictConflicts(t *testing.T) {
+	g := NewWithT(t)
+	id := "storage-" + randStringRunes(5)
+	ctx := context.Background()
+
+	err := createNamespace(id)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	s := newTestInventoryStorage()
+	s.StrictConflicts = true
+	inv := inventory.NewInventory(id, id)
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	t.Run("releases the touched fields", func(t *testing.T) {
+		err := s.Touch(ctx, inv)
+		g.Expect(err).NotTo(HaveOccurred())
+		cm, err := s.GetInventoryConfigMap(ctx, inv)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(managers(cm)).To(ContainElement(inventoryOwner.Field + "-touch"))
+
+		_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		cm, err = s.GetInventoryConfigMap(ctx, inv)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(managers(cm)).ToNot(ContainElement(inventoryOwner.Field + "-touch"))
+	})
+
+	t.Run("fails on fields owned by another manager", func(t *testing.T) {
+		cm, err := s.GetInventoryConfigMap(ctx, inv)
+		g.Expect(err).NotTo(HaveOccurred())
+		other := &unstructured.Unstructured{}
+		other.SetAPIVersion("v1")
+		other.SetKind("ConfigMap")
+		other.SetName(cm.GetName())
+		other.SetNamespace(cm.GetNamespace())
+		other.SetAnnotations(map[string]string{inventoryOwner.Group + "/revision": "2.0.0"})
+		err = envTestClient.Patch(ctx, other, client.Apply, client.FieldOwner("kubectl"), client.ForceOwnership)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		inv := inventory.NewInventory(id, id)
+		inv.SetSource("oci://registry/app", "1.0.1", nil)
+		_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+		g.Expect(errors.Is(err, inventory.ErrInventoryConflict)).To(BeTrue())
+
+		s.StrictConflicts = false
+		_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		result := inventory.NewInventory(id, id)
+		g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+		g.Expect(result.Revision).To(Equal("1.0.1"))
+	})
+}
+
+func TestInventoryStorage_FieldManager(t *testing.T) {
+	g := NewWithT(t)
+	id := "storage-" + randStringRunes(5)
+	ctx := context.Background()
+
+	err := createNamespace(id)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	s := newTestInventoryStorage()
+	inv := inventory.NewInventory(id, id)
+	_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{FieldManager: "kustomizer-staging"})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cm.GetManagedFields()).To(HaveLen(1))
+	g.Expect(cm.GetManagedFields()[0].Manager).To(Equal("kustomizer-staging"))
+	g.Expect(cm.GetManagedFields()[0].Operation).To(Equal(metav1.ManagedFieldsOperationApply))
+}
+
+func TestInventoryStorage_DryRun(t *testing.T) {
+	g := NewWithT(t)
+	id := "storage-" + randStringRunes(5)
+	ctx := context.Background()
+	s := newTestInventoryStorage()
+
+	t.Run("validates a new namespace", func(t *testing.T) {
+		inv := inventory.NewInventory(id, id)
+		result, err := s.ApplyInventory(ctx, inv, inventory.ApplyOptions{DryRun: true, CreateNamespace: true})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.Changed).To(BeTrue())
+
+		err = envTestClient.Get(ctx, client.ObjectKey{Name: id}, &corev1.Namespace{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("doesn't persist the storage object", func(t *testing.T) {
+		err := createNamespace(id)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		inv := inventory.NewInventory(id, id)
+		_, err = s.ApplyInventory(ctx, inv, inventory.ApplyOptions{DryRun: true})
+		g.Expect(err).NotTo(HaveOccurred())
+		err = s.GetInventory(ctx, inventory.NewInventory(id, id))
+		g.Expect(errors.Is(err, inventory.ErrInventoryNotFound)).To(BeTrue())
+	})
+}
+
+func managers(obj client.Object) []string {
+	var result []string
+	for _, entry := range obj.GetManagedFields() {
+		result = append(result, entry.Manager)
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ApplyInventories applies the given inventories in order with best-effort all-or-nothing semantics.
+// The stored state of all the inventories is read before applying any of them, and each apply is
+// guarded by the resource version read, unless the inventory has its own. If an apply fails, the
+// remaining inventories are skipped, and the failed inventory and the ones already applied are
+// rolled back: those that didn't exist are deleted, the others are applied again with their previous
+// entries, metadata, attachments, expiry and last applied time. A failed inventory isn't rolled back
+// on conflict, as its storage object wasn't written. The returned error aggregates the apply error,
+// the rollback errors and the list of rolled back inventories.
+//
+// The inventories are stored in distinct objects hence the operation isn't atomic: readers can observe
+// the intermediate states, and when a rollback fails or the process is interrupted, some inventories
+// are left applied. The rollback of an inventory modified by a concurrent writer in the meantime fails
+// with an error matching ErrInventoryConflict. The rollback of an inventory is recorded in its history
+// like any other apply.
+func (s *Storage) ApplyInventories(ctx context.Context, inventories []*Inventory) error {
+	previous := make([]*Inventory, len(inventories))
+	previousOpts := make([]ApplyOptions, len(inventories))
+	for n, i := range inventories {
+		stored := NewInventory(i.Name, i.Namespace)
+		opts, err := s.getInventory(ctx, stored)
+		if err != nil {
+			if errors.Is(err, ErrInventoryNotFound) {
+				continue
+			}
+			return fmt.Errorf("failed to read inventory %s/%s, error: %w", i.Namespace, i.Name, err)
+		}
+		previous[n] = stored
+		previousOpts[n] = opts
+	}
+
+	for n, i := range inventories {
+		if i.ResourceVersion == "" && previous[n] != nil {
+			i.ResourceVersion = previous[n].ResourceVersion
+		}
+		if _, err := s.ApplyInventory(ctx, i, ApplyOptions{}); err != nil {
+			errs := []error{fmt.Errorf("failed to apply inventory %s/%s, error: %w", i.Namespace, i.Name, err)}
+			last := n
+			if errors.Is(err, ErrInventoryConflict) {
+				last = n - 1
+			}
+			var rolledBack []string
+			for m := last; m >= 0; m-- {
+				// the failed inventory may be partially written, its resource version is unknown
+				resourceVersion := inventories[m].ResourceVersion
+				if m == n {
+					resourceVersion = ""
+				}
+				if err := s.restoreInventory(ctx, inventories[m], previous[m], previousOpts[m], resourceVersion); err != nil {
+					errs = append(errs, fmt.Errorf("failed to roll back inventory %s/%s, error: %w",
+						inventories[m].Namespace, inventories[m].Name, err))
+					continue
+				}
+				rolledBack = append(rolledBack, inventories[m].Namespace+"/"+inventories[m].Name)
+			}
+			if len(rolledBack) > 0 {
+				errs = append(errs, fmt.Errorf("rolled back inventories %s", strings.Join(rolledBack, ", ")))
+			}
+			return utilerrors.NewAggregate(errs)
+		}
+	}
+	return nil
+}
+
+// restoreInventory writes back the previous state of the given applied inventory with the options
+// carrying its attachments and expiry, guarded by the given resource version if not empty,
+// or deletes it if it didn't exist.
+func (s *Storage) restoreInventory(ctx context.Context, applied *Inventory, previous *Inventory, opts ApplyOptions, resourceVersion string) error {
+	if previous == nil {
+		return s.DeleteInventory(ctx, applied)
+	}
+
+	restored := previous.DeepCopy()
+	restored.ResourceVersion = resourceVersion
+	if _, err := s.ApplyInventory(ctx, restored, opts); err != nil {
+		return err
+	}
+	if previous.LastAppliedAt == "" {
+		return nil
+	}
+	return s.patchAnnotations(ctx, s.newStorageObject(restored.Name, restored.Namespace), map[string]interface{}{
+		s.Owner.Group + "/last-applied-time": previous.LastAppliedAt,
+	})
+}
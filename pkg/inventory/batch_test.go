@@ -0,0 +1,156 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_ApplyInventories(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	newInventory := func(name, namespace string, ids ...string) *Inventory {
+		inv := NewInventory(name, namespace)
+		for _, id := range ids {
+			inv.Resources = append(inv.Resources, Resource{ObjectID: id, ObjectVersion: "v1"})
+		}
+		return inv
+	}
+	for _, inv := range []*Inventory{
+		newInventory("c", "apps", "apps_c1__ConfigMap"),
+		newInventory("b", "web", "web_b1__ConfigMap"),
+	} {
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	g.Expect(s.ApplyInventories(ctx, []*Inventory{
+		newInventory("c", "apps", "apps_c2__ConfigMap"),
+		newInventory("a", "default", "default_a1__ConfigMap"),
+	})).To(Succeed())
+	applied := NewInventory("c", "apps")
+	g.Expect(s.GetInventory(ctx, applied)).To(Succeed())
+	g.Expect(applied.Resources[0].ObjectID).To(Equal("apps_c2__ConfigMap"))
+
+	stale := newInventory("b", "web", "web_b2__ConfigMap")
+	stale.ResourceVersion = "999"
+	err := s.ApplyInventories(ctx, []*Inventory{
+		newInventory("c", "apps", "apps_c3__ConfigMap"),
+		newInventory("d", "default", "default_d1__ConfigMap"),
+		stale,
+	})
+	g.Expect(err).To(MatchError(ErrInventoryConflict))
+	g.Expect(err.Error()).To(ContainSubstring("failed to apply inventory web/b"))
+	g.Expect(err.Error()).To(ContainSubstring("rolled back inventories default/d, apps/c"))
+
+	restored := NewInventory("c", "apps")
+	g.Expect(s.GetInventory(ctx, restored)).To(Succeed())
+	g.Expect(restored.Resources[0].ObjectID).To(Equal("apps_c2__ConfigMap"))
+	g.Expect(restored.LastAppliedAt).To(Equal(applied.LastAppliedAt))
+	g.Expect(s.GetInventory(ctx, NewInventory("d", "default"))).To(MatchError(ErrInventoryNotFound))
+
+	unchanged := NewInventory("b", "web")
+	g.Expect(s.GetInventory(ctx, unchanged)).To(Succeed())
+	g.Expect(unchanged.Resources[0].ObjectID).To(Equal("web_b1__ConfigMap"))
+}
+
+// forbiddenPatchClient rejects the first patch of an object with the given name prefix.
+type forbiddenPatchClient struct {
+	client.Client
+	prefix   string
+	rejected bool
+}
+
+func (c *forbiddenPatchClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if !c.rejected && strings.HasPrefix(obj.GetName(), c.prefix) {
+		c.rejected = true
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), nil)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestStorage_ApplyInventoriesPartialFailure(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 5
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b"} {
+		inv := NewInventory(name, "default")
+		inv.SetSource("oci://registry/app", "v1", nil)
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	// the storage object of b is written before its history fails
+	s.StorageClient = &forbiddenPatchClient{Client: s.Manager.Client(), prefix: storagePrefix + "b" + historySuffix}
+	var inventories []*Inventory
+	for _, name := range []string{"a", "b"} {
+		inv := NewInventory(name, "default")
+		inv.SetSource("oci://registry/app", "v2", nil)
+		inventories = append(inventories, inv)
+	}
+	err := s.ApplyInventories(ctx, inventories)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("rolled back inventories default/b, default/a"))
+
+	for _, name := range []string{"a", "b"} {
+		restored := NewInventory(name, "default")
+		g.Expect(s.GetInventory(ctx, restored)).To(Succeed())
+		g.Expect(restored.Revision).To(Equal("v1"))
+	}
+}
+
+// versionClient records the resource version of the applied objects.
+type versionClient struct {
+	client.Client
+	versions map[string]string
+}
+
+func (c *versionClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() == types.ApplyPatchType {
+		c.versions[obj.GetName()] = obj.GetResourceVersion()
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestStorage_ApplyInventoriesGuarded(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	stored := NewInventory("a", "default")
+	g.Expect(s.ApplyInventory(ctx, stored, ApplyOptions{})).Error().To(Succeed())
+
+	c := &versionClient{Client: s.Manager.Client(), versions: map[string]string{}}
+	s.StorageClient = c
+	g.Expect(s.ApplyInventories(ctx, []*Inventory{
+		NewInventory("a", "default"),
+		NewInventory("b", "default"),
+	})).To(Succeed())
+	g.Expect(c.versions).To(HaveKeyWithValue(storagePrefix+"a", stored.ResourceVersion))
+	g.Expect(c.versions).To(HaveKeyWithValue(storagePrefix+"b", ""))
+}
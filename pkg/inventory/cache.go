@@ -0,0 +1,185 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CachedStore is a Store that caches the inventories read through GetInventory for TTL,
+// the cached entry of an inventory is invalidated when it's applied or deleted through the cache.
+// It is safe for concurrent use.
+type CachedStore struct {
+	// Store is the underlying inventory store.
+	Store Store
+
+	// TTL is how long a fetched inventory is served from the cache.
+	TTL time.Duration
+
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]cacheEntry
+	generations map[string]uint64
+}
+
+type cacheEntry struct {
+	inventory *Inventory
+	expiresAt time.Time
+}
+
+var _ Store = &CachedStore{}
+
+// NewCachedStore returns a CachedStore that caches the inventories fetched from the given store for ttl.
+func NewCachedStore(store Store, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		Store: store,
+		TTL:   ttl,
+	}
+}
+
+type bypassCacheKey struct{}
+
+// WithoutCache returns a context that makes CachedStore.GetInventory read from the underlying store,
+// the fetched inventory still refreshes the cache.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+func bypassCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return bypass
+}
+
+// ApplyInventory applies the inventory to the underlying store and invalidates its cached entry.
+func (c *CachedStore) ApplyInventory(ctx context.Context, i *Inventory, opts ApplyOptions) (*ApplyResult, error) {
+	if !opts.DryRun {
+		defer c.Invalidate(i)
+	}
+	return c.Store.ApplyInventory(ctx, i, opts)
+}
+
+// GetInventory populates the given inventory from the cache if it has an unexpired entry for it,
+// otherwise from the underlying store. Like Storage.GetInventory, only the stored fields are set,
+// the fields preset by the caller that aren't stored are kept. Errors are not cached.
+func (c *CachedStore) GetInventory(ctx context.Context, i *Inventory) error {
+	k := cacheKey(i)
+	c.mu.Lock()
+	entry, ok := c.entries[k]
+	generation := c.generations[k]
+	c.mu.Unlock()
+	if ok && !bypassCache(ctx) && c.now().Before(entry.expiresAt) {
+		copyStored(i, entry.inventory.DeepCopy())
+		return nil
+	}
+
+	fetched := NewInventory(i.Name, i.Namespace)
+	if err := c.Store.GetInventory(ctx, fetched); err != nil {
+		return err
+	}
+	copyStored(i, fetched.DeepCopy())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// an inventory invalidated while it was fetched may be stale
+	if c.generations[k] != generation {
+		return nil
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[k] = cacheEntry{
+		inventory: fetched,
+		expiresAt: c.now().Add(c.TTL),
+	}
+	return nil
+}
+
+// DeleteInventory removes the inventory from the underlying store and invalidates its cached entry.
+func (c *CachedStore) DeleteInventory(ctx context.Context, i *Inventory) error {
+	defer c.Invalidate(i)
+	return c.Store.DeleteInventory(ctx, i)
+}
+
+// GetInventoryStaleObjects returns the stale objects computed by the underlying store.
+func (c *CachedStore) GetInventoryStaleObjects(ctx context.Context, i *Inventory, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	return c.Store.GetInventoryStaleObjects(ctx, i, opts)
+}
+
+// Invalidate removes the cached entry of the given inventory.
+func (c *CachedStore) Invalidate(i *Inventory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations == nil {
+		c.generations = make(map[string]uint64)
+	}
+	k := cacheKey(i)
+	c.generations[k]++
+	delete(c.entries, k)
+}
+
+func (c *CachedStore) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func cacheKey(i *Inventory) string {
+	return i.Namespace + "/" + i.Name
+}
+
+// copyStored sets on dst the fields of the given fetched inventory that are populated from the
+// storage, the fields that aren't stored keep the value preset in dst.
+func copyStored(dst, stored *Inventory) {
+	for _, field := range []struct {
+		dst   *string
+		value string
+	}{
+		{&dst.Source, stored.Source},
+		{&dst.Revision, stored.Revision},
+		{&dst.LastAppliedAt, stored.LastAppliedAt},
+		{&dst.LastAppliedChecksum, stored.LastAppliedChecksum},
+		{&dst.ExpiresAt, stored.ExpiresAt},
+		{&dst.InactiveSince, stored.InactiveSince},
+		{&dst.AppliedByVersion, stored.AppliedByVersion},
+	} {
+		if field.value != "" {
+			*field.dst = field.value
+		}
+	}
+	if stored.Inactive {
+		dst.Inactive = true
+	}
+	if stored.Artifacts != nil {
+		dst.Artifacts = stored.Artifacts
+	}
+	for k, v := range stored.Metadata {
+		if dst.Metadata == nil {
+			dst.Metadata = make(map[string]string, len(stored.Metadata))
+		}
+		dst.Metadata[k] = v
+	}
+	dst.Count = stored.Count
+	dst.Resources = stored.Resources
+	dst.ResourceVersion = stored.ResourceVersion
+}
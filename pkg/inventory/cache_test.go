@@ -0,0 +1,129 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+type countingStore struct {
+	Store
+	gets int
+}
+
+func (c *countingStore) GetInventory(ctx context.Context, i *Inventory) error {
+	c.gets++
+	return c.Store.GetInventory(ctx, i)
+}
+
+func TestCachedStore(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	now := time.Date(2021, 11, 5, 10, 30, 0, 0, time.UTC)
+	backend := &countingStore{Store: newTestStorage()}
+	c := NewCachedStore(backend, time.Minute)
+	c.Now = func() time.Time { return now }
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(c.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	first := NewInventory("test", "default")
+	g.Expect(c.GetInventory(ctx, first)).To(Succeed())
+	first.Resources[0].ObjectID = "mutated"
+
+	second := NewInventory("test", "default")
+	g.Expect(c.GetInventory(ctx, second)).To(Succeed())
+	g.Expect(second.Resources[0].ObjectID).To(Equal("default_a__ConfigMap"))
+	g.Expect(backend.gets).To(Equal(1))
+
+	g.Expect(c.GetInventory(WithoutCache(ctx), NewInventory("test", "default"))).To(Succeed())
+	g.Expect(backend.gets).To(Equal(2))
+
+	now = now.Add(2 * time.Minute)
+	g.Expect(c.GetInventory(ctx, NewInventory("test", "default"))).To(Succeed())
+	g.Expect(backend.gets).To(Equal(3))
+
+	inv.Resources = append(inv.Resources, Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"})
+	g.Expect(c.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	updated := NewInventory("test", "default")
+	g.Expect(c.GetInventory(ctx, updated)).To(Succeed())
+	g.Expect(updated.Resources).To(HaveLen(2))
+	g.Expect(backend.gets).To(Equal(4))
+
+	g.Expect(c.DeleteInventory(ctx, inv)).To(Succeed())
+	g.Expect(c.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrInventoryNotFound))
+}
+
+// racingStore runs a function after each read of the underlying store, before the read returns.
+type racingStore struct {
+	Store
+	afterGet func()
+}
+
+func (r *racingStore) GetInventory(ctx context.Context, i *Inventory) error {
+	err := r.Store.GetInventory(ctx, i)
+	if r.afterGet != nil {
+		r.afterGet()
+	}
+	return err
+}
+
+func TestCachedStore_InvalidateDuringGet(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	backend := &racingStore{Store: newTestStorage()}
+	c := NewCachedStore(backend, time.Minute)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(c.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	backend.afterGet = func() {
+		backend.afterGet = nil
+		update := NewInventory("test", "default")
+		update.Resources = append(inv.Resources, Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"})
+		g.Expect(c.ApplyInventory(ctx, update, ApplyOptions{})).Error().To(Succeed())
+	}
+	stale := NewInventory("test", "default")
+	g.Expect(c.GetInventory(ctx, stale)).To(Succeed())
+	g.Expect(stale.Resources).To(HaveLen(1))
+
+	result := NewInventory("test", "default")
+	g.Expect(c.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(HaveLen(2))
+}
+
+func TestCachedStore_PresetFields(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	c := NewCachedStore(newTestStorage(), time.Minute)
+
+	g.Expect(c.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+	g.Expect(c.GetInventory(ctx, NewInventory("test", "default"))).To(Succeed())
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	g.Expect(c.GetInventory(ctx, inv)).To(Succeed())
+	g.Expect(inv.Source).To(Equal("oci://registry/app"))
+	g.Expect(inv.Revision).To(Equal("1.0.0"))
+	g.Expect(inv.LastAppliedAt).ToNot(BeEmpty())
+}
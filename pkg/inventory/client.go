@@ -0,0 +1,101 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// NewStorage returns a ConfigMap backed inventory storage for the given cluster config and owner.
+// The resource manager is created with a dynamic REST mapper and a kstatus poller,
+// callers that need a custom setup can construct the Storage struct directly.
+func NewStorage(cfg *rest.Config, owner ssa.Owner) (*Storage, error) {
+	if err := validateOwner(owner); err != nil {
+		return nil, err
+	}
+
+	restMapper, err := apiutil.NewDynamicRESTMapper(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("REST mapper initialization failed: %w", err)
+	}
+
+	kubeClient, err := client.New(cfg, client.Options{
+		Scheme: newScheme(),
+		Mapper: restMapper,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes client initialization failed: %w", err)
+	}
+
+	statusPoller := polling.NewStatusPoller(kubeClient, restMapper, polling.Options{})
+
+	return &Storage{
+		Manager: ssa.NewResourceManager(kubeClient, statusPoller, owner),
+		Owner:   owner,
+		Retry:   DefaultRetryOptions,
+	}, nil
+}
+
+// NewStorageForContext returns an inventory storage for the given kubeconfig context.
+// If the kubeconfig path is empty, the default loading rules are used.
+func NewStorageForContext(kubeconfigPath, contextName string, owner ssa.Owner) (*Storage, error) {
+	cfg, err := configForContext(kubeconfigPath, contextName)
+	if err != nil {
+		return nil, err
+	}
+	return NewStorage(cfg, owner)
+}
+
+// configForContext loads the kubeconfig and returns the REST config of the given context.
+func configForContext(kubeconfigPath, contextName string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfigPath != "" {
+		rules = &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}
+	}
+
+	kubeconfig, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig load failed: %w", err)
+	}
+	if _, ok := kubeconfig.Contexts[contextName]; !ok {
+		return nil, fmt.Errorf("context '%s' not found in kubeconfig", contextName)
+	}
+
+	cfg, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, contextName, &clientcmd.ConfigOverrides{}, rules).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig context '%s' is invalid: %w", contextName, err)
+	}
+	return cfg, nil
+}
+
+func newScheme() *apiruntime.Scheme {
+	scheme := apiruntime.NewScheme()
+	_ = apiextensionsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+	return scheme
+}
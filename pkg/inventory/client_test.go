@@ -0,0 +1,63 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+- name: production
+  cluster:
+    server: https://production.example.com:6443
+users:
+- name: admin
+  user:
+    token: test
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+- name: production
+  context:
+    cluster: production
+    user: admin
+current-context: staging
+`
+
+func TestConfigForContext(t *testing.T) {
+	g := NewWithT(t)
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	g.Expect(os.WriteFile(path, []byte(testKubeconfig), 0600)).To(Succeed())
+
+	cfg, err := configForContext(path, "production")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cfg.Host).To(Equal("https://production.example.com:6443"))
+
+	_, err = configForContext(path, "dev")
+	g.Expect(err).To(MatchError("context 'dev' not found in kubeconfig"))
+}
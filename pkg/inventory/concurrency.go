@@ -0,0 +1,56 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the default number of parallel cluster requests made by the storage.
+const DefaultConcurrency = 4
+
+// concurrency returns the number of parallel cluster requests made by the storage.
+func (s *Storage) concurrency() int {
+	if s.Concurrency > 0 {
+		return s.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// forEach calls fn for each index in [0, count) using a bounded worker pool.
+// It stops scheduling work on the first error or when the context is cancelled.
+func (s *Storage) forEach(ctx context.Context, count int, fn func(ctx context.Context, n int) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.concurrency())
+
+	for n := 0; n < count; n++ {
+		if gctx.Err() != nil {
+			break
+		}
+		n := n
+		g.Go(func() error {
+			return fn(gctx, n)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CRDStorage stores inventories as KustomizerInventory custom resources, with the entries
+// in the spec and the source, revision and last applied time in the status.
+// The client scheme must contain the types registered by AddToScheme.
+type CRDStorage struct {
+	// Client is the client used to read and write the custom resources.
+	Client client.Client
+
+	// Owner is the field manager of the custom resources.
+	Owner ssa.Owner
+
+	// Labels replaces the app.kubernetes.io labels of the custom resources when not nil,
+	// for clusters whose label policies allow only specific labels.
+	Labels map[string]string
+
+	// Now returns the current time used for the last applied time, defaults to time.Now.
+	Now func() time.Time
+}
+
+var _ Store = &CRDStorage{}
+
+// ApplyInventory creates or updates the KustomizerInventory custom resource of the given inventory.
+// The status is written with a separate patch guarded by the resource version of the applied spec.
+// If the status patch fails, or the process stops before it, the spec holds the new entries while
+// the status still describes the previous apply, until the inventory is applied again.
+func (s *CRDStorage) ApplyInventory(ctx context.Context, i *Inventory, opts ApplyOptions) (*ApplyResult, error) {
+	if err := validateOwner(s.Owner); err != nil {
+		return nil, err
+	}
+	if opts.Validate {
+		if err := i.Validate(opts.Scope); err != nil {
+			return nil, fmt.Errorf("invalid inventory %s/%s, error: %w", i.Namespace, i.Name, err)
+		}
+	}
+
+	fieldManager := s.Owner.Field
+	if opts.FieldManager != "" {
+		fieldManager = opts.FieldManager
+	}
+	patchOpts := []client.PatchOption{client.ForceOwnership, client.FieldOwner(fieldManager)}
+	if opts.DryRun {
+		patchOpts = append(patchOpts, client.DryRunAll)
+	}
+
+	namespaceCreated := false
+	if opts.CreateNamespace && i.Namespace != "" {
+		ns := &corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: i.Namespace, Labels: s.namespaceLabels()},
+		}
+		var err error
+		if namespaceCreated, err = applyNamespace(ctx, s.Client, ns, patchOpts); err != nil {
+			return nil, fmt.Errorf("failed to create namespace %s, error: %w", i.Namespace, err)
+		}
+	}
+	// the custom resource can't be validated in a namespace that isn't persisted
+	if namespaceCreated && opts.DryRun {
+		return &ApplyResult{Changed: true}, nil
+	}
+
+	existing := &KustomizerInventory{}
+	err := s.Client.Get(ctx, client.ObjectKey{Name: i.Name, Namespace: i.Namespace}, existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	changed := apierrors.IsNotFound(err) || existing.Status.Checksum != i.Checksum() ||
+		existing.Status.Source != i.Source || existing.Status.Revision != i.Revision
+
+	entries := i.Resources
+	if entries == nil {
+		entries = []Resource{}
+	}
+	obj := &KustomizerInventory{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: CRDGroupVersion.String(),
+			Kind:       CRDKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            i.Name,
+			Namespace:       i.Namespace,
+			ResourceVersion: i.ResourceVersion,
+			Labels:          s.labels(i),
+		},
+		Spec: KustomizerInventorySpec{
+			Entries:   entries,
+			Artifacts: i.Artifacts,
+		},
+	}
+	if err := s.Client.Patch(ctx, obj, client.Apply, patchOpts...); err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, newConflictError(err)
+		}
+		return nil, err
+	}
+	if opts.DryRun {
+		return &ApplyResult{Changed: changed}, nil
+	}
+
+	lastAppliedAt := s.now().UTC().Format(time.RFC3339)
+	// the empty fields are sent as null, as a merge patch keeps the omitted fields
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": obj.GetResourceVersion(),
+		},
+		"status": map[string]interface{}{
+			"source":          nullIfEmpty(i.Source),
+			"revision":        nullIfEmpty(i.Revision),
+			"lastAppliedTime": lastAppliedAt,
+			"checksum":        i.Checksum(),
+			"entries":         len(i.Resources),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Client.Status().Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, newConflictError(err)
+		}
+		return nil, err
+	}
+
+	i.LastAppliedAt = lastAppliedAt
+	i.ResourceVersion = obj.GetResourceVersion()
+	return &ApplyResult{Changed: changed}, nil
+}
+
+// GetInventory populates the given inventory from its KustomizerInventory custom resource.
+// It returns an error matching ErrInventoryNotFound if the custom resource doesn't exist.
+func (s *CRDStorage) GetInventory(ctx context.Context, i *Inventory) error {
+	obj := &KustomizerInventory{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: i.Name, Namespace: i.Namespace}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+
+	i.Resources = obj.Spec.Entries
+	if i.Resources == nil {
+		i.Resources = []Resource{}
+	}
+	i.Artifacts = obj.Spec.Artifacts
+	i.Source = obj.Status.Source
+	i.Revision = obj.Status.Revision
+	i.LastAppliedAt = obj.Status.LastAppliedTime
+	i.LastAppliedChecksum = obj.Status.Checksum
+	i.Count = obj.Status.Entries
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// DeleteInventory removes the KustomizerInventory custom resource of the given inventory, if any.
+func (s *CRDStorage) DeleteInventory(ctx context.Context, i *Inventory) error {
+	obj := &KustomizerInventory{
+		ObjectMeta: metav1.ObjectMeta{Name: i.Name, Namespace: i.Namespace},
+	}
+	if err := s.Client.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s/%s/%s, error: %w", CRDKind, i.Namespace, i.Name, err)
+	}
+	return nil
+}
+
+// GetInventoryStaleObjects returns the list of objects metadata subject to pruning.
+func (s *CRDStorage) GetInventoryStaleObjects(ctx context.Context, i *Inventory, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	reader := *s
+	reader.Client = withReadOptions(s.Client, opts.Read)
+	return staleObjects(ctx, reader.GetInventory, i, opts)
+}
+
+// labels returns the labels of the custom resource of the given inventory,
+// or a copy of Labels when set.
+func (s *CRDStorage) labels(i *Inventory) map[string]string {
+	if s.Labels != nil {
+		labels := make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		return labels
+	}
+	return map[string]string{
+		nameLabelKey:      i.Name,
+		componentLabelKey: KindName,
+		createdByLabelKey: s.Owner.Field,
+	}
+}
+
+// namespaceLabels returns the labels of the namespace created for the custom resources,
+// or a copy of Labels when set.
+func (s *CRDStorage) namespaceLabels() map[string]string {
+	if s.Labels != nil {
+		labels := make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		return labels
+	}
+	return map[string]string{createdByLabelKey: s.Owner.Field}
+}
+
+// now returns the current time according to the storage clock.
+func (s *CRDStorage) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCRDStorage(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := apiruntime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+	now := time.Date(2021, 11, 5, 10, 30, 0, 0, time.UTC)
+	s := &CRDStorage{
+		Client: &applyClient{fake.NewClientBuilder().WithScheme(scheme).Build()},
+		Owner:  testOwner,
+		Now:    func() time.Time { return now },
+	}
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+	}
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Resources).To(Equal(inv.Resources))
+	g.Expect(stored.Source).To(Equal(inv.Source))
+	g.Expect(stored.Revision).To(Equal(inv.Revision))
+	g.Expect(stored.LastAppliedAt).To(Equal("2021-11-05T10:30:00Z"))
+
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeFalse())
+
+	current := NewInventory("test", "default")
+	current.Resources = inv.Resources[:1]
+	stale, err := s.GetInventoryStaleObjects(ctx, current, PruneOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(1))
+	g.Expect(stale[0].GetName()).To(Equal("b"))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, stored)).To(MatchError(ErrInventoryNotFound))
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+}
+
+// statusRecorder records the status patches.
+type statusRecorder struct {
+	client.Client
+	patches []string
+}
+
+func (c *statusRecorder) Status() client.StatusWriter {
+	return &recordingStatusWriter{StatusWriter: c.Client.Status(), recorder: c}
+}
+
+type recordingStatusWriter struct {
+	client.StatusWriter
+	recorder *statusRecorder
+}
+
+func (w *recordingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	w.recorder.patches = append(w.recorder.patches, string(data))
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func TestCRDStorage_ClearStatus(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := apiruntime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+	c := &statusRecorder{Client: &applyClient{fake.NewClientBuilder().WithScheme(scheme).Build()}}
+	s := &CRDStorage{
+		Client: c,
+		Owner:  testOwner,
+	}
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	inv.SetSource("", "", nil)
+	inv.Resources = nil
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(c.patches).To(HaveLen(2))
+	g.Expect(c.patches[1]).To(ContainSubstring(`"source":null`))
+	g.Expect(c.patches[1]).To(ContainSubstring(`"revision":null`))
+	g.Expect(c.patches[1]).To(ContainSubstring(`"entries":0`))
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Source).To(BeEmpty())
+	g.Expect(stored.Count).To(BeZero())
+}
+
+func TestCRDStorage_Labels(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := apiruntime.NewScheme()
+	_ = AddToScheme(scheme)
+	c := &applyClient{fake.NewClientBuilder().WithScheme(scheme).Build()}
+	s := &CRDStorage{
+		Client: c,
+		Owner:  testOwner,
+		Labels: map[string]string{"team": "platform"},
+	}
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	obj := &KustomizerInventory{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, obj)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(Equal(map[string]string{"team": "platform"}))
+}
+
+func TestCRDStorage_CreateNamespace(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := apiruntime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+	existing := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "platform"}}}
+	c := &applyClient{fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()}
+	s := &CRDStorage{
+		Client: c,
+		Owner:  testOwner,
+	}
+
+	inv := NewInventory("test", "apps")
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true, DryRun: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+	err = c.Get(ctx, client.ObjectKey{Name: "apps"}, &corev1.Namespace{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true})).Error().To(Succeed())
+	ns := &corev1.Namespace{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: "apps"}, ns)).To(Succeed())
+	g.Expect(ns.GetLabels()).To(HaveKeyWithValue(createdByLabelKey, testOwner.Field))
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{CreateNamespace: true})).Error().To(Succeed())
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: "default"}, ns)).To(Succeed())
+	g.Expect(ns.GetLabels()).To(Equal(existing.GetLabels()))
+	g.Expect(ns.GetManagedFields()).To(BeEmpty())
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// CRDKind is the kind of the custom resource used by CRDStorage.
+	CRDKind = "KustomizerInventory"
+
+	crdPlural = "kustomizerinventories"
+)
+
+var (
+	// CRDGroupVersion is the API group and version of the KustomizerInventory custom resource.
+	CRDGroupVersion = schema.GroupVersion{Group: "inventory.kustomizer.dev", Version: "v1beta1"}
+
+	// SchemeBuilder registers the KustomizerInventory types.
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+
+	// AddToScheme adds the KustomizerInventory types to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(CRDGroupVersion, &KustomizerInventory{}, &KustomizerInventoryList{})
+	metav1.AddToGroupVersion(scheme, CRDGroupVersion)
+	return nil
+}
+
+// KustomizerInventory is a custom resource holding an inventory,
+// the entries are stored in the spec and the apply details in the status.
+type KustomizerInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KustomizerInventorySpec   `json:"spec,omitempty"`
+	Status KustomizerInventoryStatus `json:"status,omitempty"`
+}
+
+// KustomizerInventorySpec contains the entries of an inventory.
+type KustomizerInventorySpec struct {
+	// Entries is the list of Kubernetes object IDs.
+	Entries []Resource `json:"entries"`
+
+	// Artifacts is the list of the OCI URLs.
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// KustomizerInventoryStatus contains the details of the last successful apply.
+type KustomizerInventoryStatus struct {
+	// Source is the repository URL.
+	Source string `json:"source,omitempty"`
+
+	// Revision is the source revision identifier.
+	Revision string `json:"revision,omitempty"`
+
+	// LastAppliedTime is the timestamp (UTC RFC3339) of the last successful apply.
+	LastAppliedTime string `json:"lastAppliedTime,omitempty"`
+
+	// Checksum is the checksum of the entries recorded at the last successful apply.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Entries is the number of entries recorded at the last successful apply.
+	Entries int `json:"entries,omitempty"`
+}
+
+// KustomizerInventoryList is a list of KustomizerInventory objects.
+type KustomizerInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []KustomizerInventory `json:"items"`
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *KustomizerInventory) DeepCopyInto(out *KustomizerInventory) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Entries != nil {
+		out.Spec.Entries = make([]Resource, len(in.Spec.Entries))
+		copy(out.Spec.Entries, in.Spec.Entries)
+	}
+	if in.Spec.Artifacts != nil {
+		out.Spec.Artifacts = make([]string, len(in.Spec.Artifacts))
+		copy(out.Spec.Artifacts, in.Spec.Artifacts)
+	}
+}
+
+// DeepCopy returns a copy of the receiver.
+func (in *KustomizerInventory) DeepCopy() *KustomizerInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizerInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *KustomizerInventory) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *KustomizerInventoryList) DeepCopyInto(out *KustomizerInventoryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]KustomizerInventory, len(in.Items))
+		for n := range in.Items {
+			in.Items[n].DeepCopyInto(&out.Items[n])
+		}
+	}
+}
+
+// DeepCopy returns a copy of the receiver.
+func (in *KustomizerInventoryList) DeepCopy() *KustomizerInventoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizerInventoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *KustomizerInventoryList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// CustomResourceDefinition returns the definition of the KustomizerInventory custom resource,
+// which must be installed on the cluster before using CRDStorage.
+func CustomResourceDefinition() *apiextensionsv1.CustomResourceDefinition {
+	str := apiextensionsv1.JSONSchemaProps{Type: "string"}
+	entry := apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"id", "ver"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"id":     str,
+			"ver":    str,
+			"status": str,
+			"digest": str,
+		},
+	}
+
+	return &apiextensionsv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: crdPlural + "." + CRDGroupVersion.Group,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: CRDGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:   crdPlural,
+				Singular: "kustomizerinventory",
+				Kind:     CRDKind,
+				ListKind: CRDKind + "List",
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    CRDGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+				},
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"apiVersion": str,
+							"kind":       str,
+							"metadata":   {Type: "object"},
+							"spec": {
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"entries": {
+										Type:  "array",
+										Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &entry},
+									},
+									"artifacts": {
+										Type:  "array",
+										Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &str},
+									},
+								},
+							},
+							"status": {
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"source":          str,
+									"revision":        str,
+									"lastAppliedTime": str,
+									"checksum":        str,
+									"entries":         {Type: "integer"},
+								},
+							},
+						},
+					},
+				},
+			}},
+		},
+	}
+}
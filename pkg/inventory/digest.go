@@ -0,0 +1,210 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// ManagedObjectDigest returns the SHA256 checksum of the fields applied by the given field manager
+// to the given live object, as recorded in its managed fields. Unlike the object content, these
+// fields aren't changed by the server defaults and by the other controllers, unless the fields
+// managed by the field manager are modified. It returns an empty digest if the object has
+// no fields applied by the field manager.
+func ManagedObjectDigest(obj *unstructured.Unstructured, manager string) (string, error) {
+	var fields []interface{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply ||
+			entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+		set := map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &set); err != nil {
+			return "", fmt.Errorf("failed to decode the managed fields of %s, error: %w", object.UnstructuredToObjMetadata(obj), err)
+		}
+		fields = append(fields, extractFields(obj.Object, set))
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s, error: %w", object.UnstructuredToObjMetadata(obj), err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// extractFields returns the parts of the given value selected by the given managed fields set,
+// whose keys are the 'f:<name>' fields, the 'k:<keys>' and 'v:<value>' list items, and the
+// 'i:<index>' list positions. The list items are returned in their original order.
+func extractFields(value interface{}, set map[string]interface{}) interface{} {
+	leaf := true
+	for key := range set {
+		if key != "." {
+			leaf = false
+			break
+		}
+	}
+	if leaf {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(set))
+		for key, child := range set {
+			name := strings.TrimPrefix(key, "f:")
+			if name == key {
+				continue
+			}
+			if field, ok := v[name]; ok {
+				childSet, _ := child.(map[string]interface{})
+				result[name] = extractFields(field, childSet)
+			}
+		}
+		return result
+	case []interface{}:
+		var result []interface{}
+		for index, item := range v {
+			for key, child := range set {
+				if matchListItem(key, index, item) {
+					childSet, _ := child.(map[string]interface{})
+					result = append(result, extractFields(item, childSet))
+					break
+				}
+			}
+		}
+		return result
+	}
+	return value
+}
+
+// matchListItem returns true if the given list item is selected by the given managed fields key.
+func matchListItem(key string, index int, item interface{}) bool {
+	switch {
+	case strings.HasPrefix(key, "k:"):
+		keys := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &keys); err != nil {
+			return false
+		}
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range keys {
+			if !equalJSON(fields[k], v) {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(key, "v:"):
+		var value interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "v:")), &value); err != nil {
+			return false
+		}
+		return equalJSON(item, value)
+	case strings.HasPrefix(key, "i:"):
+		return strings.TrimPrefix(key, "i:") == strconv.Itoa(index)
+	}
+	return false
+}
+
+// equalJSON returns true if the given values have the same JSON encoding,
+// regardless of their numeric types.
+func equalJSON(a, b interface{}) bool {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(aj) == string(bj)
+}
+
+// SetObjectDigests records in the matching inventory entries the digest of the fields applied by the
+// given field manager to the given live objects, as returned by ManagedObjectDigest. The objects
+// must be read from the cluster after they are applied, as the desired objects have no managed fields.
+func (inv *Inventory) SetObjectDigests(objects []*unstructured.Unstructured, manager string) error {
+	index := make(map[string]int, len(inv.Resources))
+	for n, entry := range inv.Resources {
+		index[entry.ObjectID] = n
+	}
+
+	for _, obj := range objects {
+		n, ok := index[object.UnstructuredToObjMetadata(obj).String()]
+		if !ok {
+			continue
+		}
+		digest, err := ManagedObjectDigest(obj, manager)
+		if err != nil {
+			return err
+		}
+		inv.Resources[n].Digest = digest
+	}
+	return nil
+}
+
+// RecordObjectDigests reads the given objects from the cluster and records in the matching entries of
+// the given inventory the digest of the fields applied by the owner, it must be called after the objects
+// are applied. Objects that don't exist are left without a digest.
+func (s *Storage) RecordObjectDigests(ctx context.Context, i *Inventory, objects []*unstructured.Unstructured) error {
+	live := make([]*unstructured.Unstructured, len(objects))
+	err := s.forEach(ctx, len(objects), func(ctx context.Context, n int) error {
+		obj, err := s.liveObject(ctx, objects[n])
+		live[n] = obj
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var existing []*unstructured.Unstructured
+	for _, obj := range live {
+		if obj != nil {
+			existing = append(existing, obj)
+		}
+	}
+	return i.SetObjectDigests(existing, s.Owner.Field)
+}
+
+// DriftedEntries returns the entries whose recorded digest differs from the live digest found
+// in the given map keyed by object ID, as returned by ManagedObjectDigest. Entries without
+// a recorded digest and entries missing from the map are considered unknown and aren't returned.
+func (inv *Inventory) DriftedEntries(live map[string]string) []Resource {
+	var drifted []Resource
+	for _, entry := range inv.Resources {
+		if entry.Digest == "" {
+			continue
+		}
+		if digest, ok := live[entry.ObjectID]; ok && digest != entry.Digest {
+			drifted = append(drifted, entry)
+		}
+	}
+	return drifted
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestManagedObjectDigest(t *testing.T) {
+	g := NewWithT(t)
+
+	newDeployment := func(image string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "app",
+				"namespace": "default",
+				"labels":    map[string]interface{}{"app": "web"},
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(2),
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "app", "image": image},
+						},
+					},
+				},
+			},
+		}}
+		u.SetManagedFields([]metav1.ManagedFieldsEntry{
+			{
+				Manager:   "kustomizer",
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{".":{},"f:app":{}}},` +
+					`"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"app\"}":{".":{},"f:image":{},"f:name":{}}}}}}}`)},
+			},
+			{
+				Manager:   "kube-controller-manager",
+				Operation: metav1.ManagedFieldsOperationUpdate,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)},
+			},
+		})
+		return u
+	}
+
+	applied := newDeployment("app:v1")
+	digest, err := ManagedObjectDigest(applied, "kustomizer")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(digest).ToNot(BeEmpty())
+
+	live := applied.DeepCopy()
+	live.SetResourceVersion("42")
+	live.SetAnnotations(map[string]string{"deployment.kubernetes.io/revision": "3"})
+	live.SetFinalizers([]string{"example.com/finalizer"})
+	g.Expect(unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas")).To(Succeed())
+	g.Expect(unstructured.SetNestedField(live.Object, "Always", "spec", "template", "spec", "restartPolicy")).To(Succeed())
+	liveDigest, err := ManagedObjectDigest(live, "kustomizer")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(liveDigest).To(Equal(digest))
+
+	drifted, err := ManagedObjectDigest(newDeployment("app:v2"), "kustomizer")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(drifted).ToNot(Equal(digest))
+
+	unmanaged, err := ManagedObjectDigest(applied, "kubectl")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(unmanaged).To(BeEmpty())
+}
+
+func TestDriftedEntries(t *testing.T) {
+	g := NewWithT(t)
+
+	newConfigMap := func(name, value string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		u.SetName(name)
+		u.SetNamespace("default")
+		g.Expect(unstructured.SetNestedField(u.Object, value, "data", "key")).To(Succeed())
+		u.SetManagedFields([]metav1.ManagedFieldsEntry{{
+			Manager:   "kustomizer",
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:key":{}}}`)},
+		}})
+		return u
+	}
+
+	objects := []*unstructured.Unstructured{newConfigMap("a", "1"), newConfigMap("b", "1")}
+	inv := NewInventory("test", "default")
+	g.Expect(inv.AddObjects(objects)).To(Succeed())
+	g.Expect(inv.SetObjectDigests(objects, "kustomizer")).To(Succeed())
+
+	unchanged := objects[0].DeepCopy()
+	unchanged.SetResourceVersion("42")
+	sameDigest, err := ManagedObjectDigest(unchanged, "kustomizer")
+	g.Expect(err).ToNot(HaveOccurred())
+	changedDigest, err := ManagedObjectDigest(newConfigMap("b", "2"), "kustomizer")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	live := map[string]string{
+		inv.Resources[0].ObjectID: sameDigest,
+		inv.Resources[1].ObjectID: changedDigest,
+	}
+	drifted := inv.DriftedEntries(live)
+	g.Expect(drifted).To(HaveLen(1))
+	g.Expect(drifted[0].ObjectID).To(Equal(inv.Resources[1].ObjectID))
+
+	inv.Resources[1].Digest = ""
+	g.Expect(inv.DriftedEntries(live)).To(BeEmpty())
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// appendApplyAttempts is the number of attempts of AppendApply to create a missing inventory
+// whose creation is taken over by other writers.
+const appendApplyAttempts = 3
+
+// AddEntries adds the given entries to the stored inventory, entries with an object ID already
+// present replace the existing ones. The inventory is read and written back guarded by its
+// resource version, if another writer modified it in the meantime, an error matching
+// ErrInventoryConflict is returned. On success, the given inventory reflects the stored state.
+func (s *Storage) AddEntries(ctx context.Context, i *Inventory, entries ...Resource) error {
+	return s.updateEntries(ctx, i, func(resources []Resource) ([]Resource, bool) {
+		return mergeEntries(resources, entries)
+	})
+}
+
+// AppendApply applies the given inventory with additive semantics: its entries are merged into the
+// entries of the stored inventory instead of replacing them, entries with an object ID already present
+// replace the existing ones. This allows several callers to share one inventory, each writing its own
+// metadata and entries, without dropping the entries of the others. The inventory is read and written
+// back guarded by its resource version, if another writer modified it in the meantime, an error matching
+// ErrInventoryConflict is returned. On success, the given inventory contains the merged entries.
+//
+// An inventory that isn't stored yet is created only if it doesn't exist, so that concurrent first
+// writers don't overwrite each other: the losers merge their entries into the created inventory.
+//
+// Unlike ApplyInventory, the entries removed by a caller are never dropped, hence the stale objects
+// computed from an appended inventory are empty. Entries must be removed explicitly with RemoveEntries,
+// and the source, revision and metadata of the stored inventory are those of the last caller.
+func (s *Storage) AppendApply(ctx context.Context, i *Inventory) error {
+	for attempt := 1; ; attempt++ {
+		created, err := s.createInventory(ctx, i)
+		if err == nil {
+			if created {
+				return nil
+			}
+			break
+		}
+		// another writer created the inventory in the meantime
+		if !errors.Is(err, ErrInventoryConflict) || attempt >= appendApplyAttempts {
+			return err
+		}
+	}
+
+	stored := NewInventory(i.Name, i.Namespace)
+	opts, err := s.getInventory(ctx, stored)
+	if err != nil {
+		return err
+	}
+
+	i.Resources, _ = mergeEntries(stored.Resources, i.Resources)
+	i.ResourceVersion = stored.ResourceVersion
+	_, err = s.ApplyInventory(ctx, i, opts)
+	return err
+}
+
+// createInventory applies the given inventory if it isn't stored yet, and returns false if it is.
+// An empty storage object is created first, as a server-side apply can't require the object to be
+// missing, then the inventory is applied guarded by the resource version of the empty object.
+// The empty object left by a pending or interrupted creation is taken over, a writer whose creation
+// was taken over fails with an error matching ErrInventoryConflict.
+func (s *Storage) createInventory(ctx context.Context, i *Inventory) (bool, error) {
+	obj, err := s.getStorageObject(ctx, i)
+	switch {
+	case errors.Is(err, ErrInventoryNotFound):
+		obj = s.emptyStorageObject()
+		obj.SetName(s.storageName(i.Name, i.Namespace))
+		obj.SetNamespace(s.storageNamespace(i.Name, i.Namespace))
+		s.setObjectKeys(obj, map[string]string{s.createdByLabel(): s.createdBy()})
+		if err := s.client().Create(ctx, obj, client.FieldOwner(s.Owner.Field)); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return false, newConflictError(err)
+			}
+			return false, err
+		}
+	case err != nil:
+		return false, err
+	case len(getStorageData(obj)) > 0:
+		return false, nil
+	}
+
+	i.ResourceVersion = obj.GetResourceVersion()
+	if _, err := s.ApplyInventory(ctx, i, ApplyOptions{}); err != nil {
+		i.ResourceVersion = ""
+		return false, err
+	}
+	return true, nil
+}
+
+// mergeEntries adds the given entries to the resources, entries with an object ID already present
+// replace the existing ones. It returns true if the resources changed.
+func mergeEntries(resources []Resource, entries []Resource) ([]Resource, bool) {
+	changed := false
+	index := make(map[string]int, len(resources))
+	for n, entry := range resources {
+		index[entry.ObjectID] = n
+	}
+
+	for _, entry := range entries {
+		if n, ok := index[entry.ObjectID]; ok {
+			if resources[n] != entry {
+				resources[n] = entry
+				changed = true
+			}
+			continue
+		}
+		index[entry.ObjectID] = len(resources)
+		resources = append(resources, entry)
+		changed = true
+	}
+	return resources, changed
+}
+
+// RemoveEntries removes the entries with the given object IDs from the stored inventory,
+// entries not present are ignored. The inventory is read and written back guarded by its
+// resource version, if another writer modified it in the meantime, an error matching
+// ErrInventoryConflict is returned. On success, the given inventory reflects the stored state.
+func (s *Storage) RemoveEntries(ctx context.Context, i *Inventory, entries ...Resource) error {
+	return s.updateEntries(ctx, i, func(resources []Resource) ([]Resource, bool) {
+		removed := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			removed[entry.ObjectID] = true
+		}
+
+		result := make([]Resource, 0, len(resources))
+		for _, entry := range resources {
+			if !removed[entry.ObjectID] {
+				result = append(result, entry)
+			}
+		}
+		return result, len(result) != len(resources)
+	})
+}
+
+// CompactInventory removes the duplicate entries of the stored inventory, keeping the last
+// occurrence of each object ID, and returns the number of removed entries. The inventory is
+// written back only if duplicates were found, guarded by its resource version.
+func (s *Storage) CompactInventory(ctx context.Context, i *Inventory) (removed int, err error) {
+	err = s.updateEntries(ctx, i, func(resources []Resource) ([]Resource, bool) {
+		seen := make(map[string]bool, len(resources))
+		result := make([]Resource, 0, len(resources))
+		for n := len(resources) - 1; n >= 0; n-- {
+			if !seen[resources[n].ObjectID] {
+				seen[resources[n].ObjectID] = true
+				result = append(result, resources[n])
+			}
+		}
+		for a, b := 0, len(result)-1; a < b; a, b = a+1, b-1 {
+			result[a], result[b] = result[b], result[a]
+		}
+		removed = len(resources) - len(result)
+		return result, removed > 0
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// updateEntries reads the stored inventory, applies the given mutation to its entries
+// and writes it back with its attachments and expiry if the entries changed.
+func (s *Storage) updateEntries(ctx context.Context, i *Inventory, mutate func([]Resource) ([]Resource, bool)) error {
+	opts, err := s.getInventory(ctx, i)
+	if err != nil {
+		return err
+	}
+
+	resources, changed := mutate(i.Resources)
+	if !changed {
+		return nil
+	}
+	i.Resources = resources
+
+	_, err = s.ApplyInventory(ctx, i, opts)
+	return err
+}
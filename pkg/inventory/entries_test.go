@@ -0,0 +1,210 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_AddRemoveEntries(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	a := Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}
+	b := Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"}
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{a}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	g.Expect(s.AddEntries(ctx, NewInventory("test", "default"), a, b, b)).To(Succeed())
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal([]Resource{a, b}))
+
+	g.Expect(s.RemoveEntries(ctx, result, a, Resource{ObjectID: "default_c__ConfigMap"})).To(Succeed())
+	g.Expect(result.Resources).To(Equal([]Resource{b}))
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal([]Resource{b}))
+
+	err := s.AddEntries(ctx, NewInventory("missing", "default"), a)
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestStorage_CompactInventory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.PreserveOrder = true
+	ctx := context.Background()
+
+	a := Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}
+	b := Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"}
+	b2 := Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1", Status: ResourceApplied}
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{b, a, a, b2}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	removed, err := s.CompactInventory(ctx, result)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(removed).To(Equal(2))
+	g.Expect(result.Resources).To(Equal([]Resource{a, b2}))
+
+	resourceVersion := result.ResourceVersion
+	removed, err = s.CompactInventory(ctx, result)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(removed).To(BeZero())
+	g.Expect(result.ResourceVersion).To(Equal(resourceVersion))
+}
+
+func TestStorage_AppendApply(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	first := NewInventory("shared", "default")
+	first.SetSource("oci://registry/first", "v1", nil)
+	first.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.AppendApply(ctx, first)).To(Succeed())
+
+	second := NewInventory("shared", "default")
+	second.SetSource("oci://registry/second", "v1", nil)
+	second.Resources = []Resource{{ObjectID: "default_c__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.AppendApply(ctx, second)).To(Succeed())
+	g.Expect(second.Resources).To(HaveLen(3))
+
+	first.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.AppendApply(ctx, first)).To(Succeed())
+
+	stored := NewInventory("shared", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Source).To(Equal("oci://registry/first"))
+	g.Expect(stored.Resources).To(ConsistOf(
+		Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+		Resource{ObjectID: "default_c__ConfigMap", ObjectVersion: "v1"},
+	))
+
+	stale, err := s.GetInventoryStaleObjects(ctx, first, PruneOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(BeEmpty())
+}
+
+// createHookClient runs a function after the next object is created.
+type createHookClient struct {
+	client.Client
+	afterCreate func()
+}
+
+func (c *createHookClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	if hook := c.afterCreate; hook != nil {
+		c.afterCreate = nil
+		hook()
+	}
+	return nil
+}
+
+func TestStorage_AppendApplyConcurrentCreate(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	c := &createHookClient{Client: s.Manager.Client()}
+	s.StorageClient = c
+	s.HistoryLimit = 2
+	ctx := context.Background()
+
+	a := Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}
+	b := Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"}
+
+	// the second writer takes over the creation of the first one before it applies the inventory
+	c.afterCreate = func() {
+		second := NewInventory("shared", "default")
+		second.Resources = []Resource{b}
+		g.Expect(s.AppendApply(ctx, second)).To(Succeed())
+		g.Expect(second.Resources).To(ConsistOf(b))
+	}
+	first := NewInventory("shared", "default")
+	first.Resources = []Resource{a}
+	g.Expect(s.AppendApply(ctx, first)).To(Succeed())
+	g.Expect(first.Resources).To(ConsistOf(a, b))
+
+	stored := NewInventory("shared", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Resources).To(ConsistOf(a, b))
+}
+
+func TestStorage_RewriteKeepsAttachmentsAndExpiry(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 5
+	ctx := context.Background()
+
+	a := Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}
+	b := Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"}
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{a}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	inv.SetSource("oci://registry/app", "1.0.1", nil)
+	opts := ApplyOptions{
+		Attachments: map[string]string{"report": "no changes"},
+		TTL:         time.Hour,
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, opts)).Error().To(Succeed())
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+
+	for _, rewrite := range []func() error{
+		func() error { return s.AddEntries(ctx, NewInventory("test", "default"), b, b) },
+		func() error { _, err := s.CompactInventory(ctx, NewInventory("test", "default")); return err },
+		func() error { return s.RemoveEntries(ctx, NewInventory("test", "default"), b) },
+		func() error {
+			appended := NewInventory("test", "default")
+			appended.Resources = []Resource{b}
+			return s.AppendApply(ctx, appended)
+		},
+		func() error { return s.RestoreRevision(ctx, NewInventory("test", "default"), "1.0.0") },
+		func() error {
+			failing := NewInventory("other", "default")
+			failing.ResourceVersion = "999"
+			err := s.ApplyInventories(ctx, []*Inventory{NewInventory("test", "default"), failing})
+			g.Expect(err).To(MatchError(ContainSubstring("rolled back inventories default/other, default/test")))
+			return nil
+		},
+	} {
+		g.Expect(rewrite()).To(Succeed())
+		result := NewInventory("test", "default")
+		g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+		g.Expect(result.ExpiresAt).To(Equal(stored.ExpiresAt))
+		g.Expect(s.GetAttachment(ctx, result, "report")).To(Equal("no changes"))
+	}
+}
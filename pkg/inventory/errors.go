@@ -0,0 +1,93 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInventoryNotFound is returned when the inventory storage object or its data does not exist.
+	ErrInventoryNotFound = errors.New("inventory not found")
+
+	// ErrInventoryConflict is returned when the inventory storage object was modified by another writer.
+	ErrInventoryConflict = errors.New("inventory conflict")
+
+	// ErrOwnershipConflict is returned when the storage object exists but wasn't created by the inventory storage.
+	ErrOwnershipConflict = errors.New("inventory ownership conflict")
+
+	// ErrMetadataDrift is returned when the source or revision of the tracked objects differs from the inventory.
+	ErrMetadataDrift = errors.New("inventory metadata drift")
+
+	// ErrCorruptInventory is returned when the inventory data can't be parsed.
+	ErrCorruptInventory = errors.New("inventory data corrupted")
+
+	// ErrSignatureMismatch is returned when the signature of the inventory data is missing or invalid.
+	ErrSignatureMismatch = errors.New("inventory signature mismatch")
+
+	// ErrStop can be returned by the GetInventoryEntries callback to stop the iteration early.
+	ErrStop = errors.New("stop iteration")
+)
+
+// inventoryError matches a sentinel error with errors.Is while keeping the underlying error wrapped.
+type inventoryError struct {
+	sentinel error
+	err      error
+}
+
+func (e *inventoryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.sentinel, e.err)
+}
+
+func (e *inventoryError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *inventoryError) Unwrap() error {
+	return e.err
+}
+
+// newNotFoundError wraps the given error so that it matches both ErrInventoryNotFound and the original error.
+func newNotFoundError(err error) error {
+	return &inventoryError{sentinel: ErrInventoryNotFound, err: err}
+}
+
+// newConflictError wraps the given error so that it matches both ErrInventoryConflict and the original error.
+func newConflictError(err error) error {
+	return &inventoryError{sentinel: ErrInventoryConflict, err: err}
+}
+
+// newOwnershipError wraps the given error so that it matches both ErrOwnershipConflict and the original error.
+func newOwnershipError(err error) error {
+	return &inventoryError{sentinel: ErrOwnershipConflict, err: err}
+}
+
+// newMetadataDriftError wraps the given error so that it matches both ErrMetadataDrift and the original error.
+func newMetadataDriftError(err error) error {
+	return &inventoryError{sentinel: ErrMetadataDrift, err: err}
+}
+
+// newCorruptError wraps the given error so that it matches both ErrCorruptInventory and the original error.
+func newCorruptError(err error) error {
+	return &inventoryError{sentinel: ErrCorruptInventory, err: err}
+}
+
+// newSignatureError wraps the given error so that it matches both ErrSignatureMismatch and the original error.
+func newSignatureError(err error) error {
+	return &inventoryError{sentinel: ErrSignatureMismatch, err: err}
+}
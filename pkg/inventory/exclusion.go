@@ -0,0 +1,91 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"path"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PruneOptions contains options for GetInventoryStaleObjects.
+type PruneOptions struct {
+	// Exclusions match the objects that are never reported as stale.
+	Exclusions []Exclusion
+
+	// Namespace restricts the stale objects to the given namespace, cluster-scoped
+	// objects are reported only when empty.
+	Namespace string
+
+	// Progress is called after each entry of the stored inventory is compared, optional.
+	Progress ProgressFunc
+
+	// Read tunes the API reads made to fetch the stored inventory.
+	Read ReadOptions
+}
+
+// Exclusion matches objects by kind and name.
+type Exclusion struct {
+	// GroupVersionKind is the kind of the excluded objects,
+	// an empty version matches all the versions of the kind.
+	GroupVersionKind schema.GroupVersionKind
+
+	// Name is a glob pattern matching the name of the excluded objects,
+	// empty matches all the objects of the kind.
+	Name string
+}
+
+// Matches returns true if the given object is matched by this exclusion.
+func (e Exclusion) Matches(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != e.GroupVersionKind.Group || gvk.Kind != e.GroupVersionKind.Kind {
+		return false
+	}
+	if e.GroupVersionKind.Version != "" && gvk.Version != e.GroupVersionKind.Version {
+		return false
+	}
+	if e.Name == "" {
+		return true
+	}
+	matched, err := path.Match(e.Name, obj.GetName())
+	return err == nil && matched
+}
+
+// Filter returns the given objects without the ones matched by the exclusions
+// and, if a namespace is set, without the objects outside of that namespace.
+func (o PruneOptions) Filter(objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	result := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		if !o.excluded(obj) {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+func (o PruneOptions) excluded(obj *unstructured.Unstructured) bool {
+	if o.Namespace != "" && obj.GetNamespace() != o.Namespace {
+		return true
+	}
+	for _, exclusion := range o.Exclusions {
+		if exclusion.Matches(obj) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+)
+
+// expiryAnnotation returns the annotation holding the expiry time of an inventory applied with a TTL.
+func (s *Storage) expiryAnnotation() string {
+	return s.Owner.Group + "/expiry"
+}
+
+// ListExpired returns the inventories in the given namespace whose expiry time has passed,
+// without their entries. If the namespace is empty, the inventories are listed across all namespaces.
+func (s *Storage) ListExpired(ctx context.Context, namespace string) ([]*Inventory, error) {
+	inventories, err := s.ListInventoriesMeta(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var expired []*Inventory
+	for _, i := range inventories {
+		if i.expiredAt(now) {
+			expired = append(expired, i)
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_ListExpired(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	now := time.Date(2021, 11, 5, 10, 30, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("preview", "default"), ApplyOptions{TTL: time.Hour})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, NewInventory("prod", "default"), ApplyOptions{})).Error().To(Succeed())
+
+	inv := NewInventory("preview", "default")
+	g.Expect(s.GetInventory(ctx, inv)).To(Succeed())
+	g.Expect(inv.ExpiresAt).To(Equal("2021-11-05T11:30:00Z"))
+	g.Expect(inv.IsExpired()).To(BeTrue())
+	g.Expect(inv.Metadata).To(BeEmpty())
+
+	expired, err := s.ListExpired(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(expired).To(BeEmpty())
+
+	now = now.Add(2 * time.Hour)
+	expired, err = s.ListExpired(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(expired).To(HaveLen(1))
+	g.Expect(expired[0].Name).To(Equal("preview"))
+
+	prod := NewInventory("prod", "default")
+	g.Expect(s.GetInventory(ctx, prod)).To(Succeed())
+	g.Expect(prod.IsExpired()).To(BeFalse())
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/yaml"
+)
+
+// inventoryExport is the human-friendly representation of an inventory.
+type inventoryExport struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Source          string            `json:"source,omitempty"`
+	Revision        string            `json:"revision,omitempty"`
+	LastAppliedTime string            `json:"lastAppliedTime,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Entries         []entryExport     `json:"entries"`
+	Artifacts       []string          `json:"artifacts,omitempty"`
+}
+
+// entryExport is the human-friendly representation of an inventory entry.
+type entryExport struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Namespace  string         `json:"namespace,omitempty"`
+	Name       string         `json:"name"`
+	Status     ResourceStatus `json:"status,omitempty"`
+	Digest     string         `json:"digest,omitempty"`
+}
+
+// ToJSON returns the inventory as indented JSON with the entries sorted by object ID.
+func (inv *Inventory) ToJSON() ([]byte, error) {
+	export, err := inv.export()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// ToYAML returns the inventory as YAML with the entries sorted by object ID.
+func (inv *Inventory) ToYAML() ([]byte, error) {
+	export, err := inv.export()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(export)
+}
+
+// ToResourceList returns the objects tracked by the inventory as a YAML v1 List of object references,
+// each item containing only the apiVersion, kind, name and namespace. The items are in apply order.
+func (inv *Inventory) ToResourceList() ([]byte, error) {
+	objects, err := inv.ListObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		items = append(items, obj.Object)
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+}
+
+// InventoryFromYAML returns the inventory from the YAML or JSON produced by ToYAML or ToJSON.
+func InventoryFromYAML(data []byte) (*Inventory, error) {
+	var export inventoryExport
+	if err := yaml.UnmarshalStrict(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory, error: %w", err)
+	}
+
+	inv := NewInventory(export.Name, export.Namespace)
+	inv.Source = export.Source
+	inv.Revision = export.Revision
+	inv.LastAppliedAt = export.LastAppliedTime
+	inv.Metadata = export.Metadata
+	inv.Artifacts = export.Artifacts
+	for _, entry := range export.Entries {
+		gv, err := schema.ParseGroupVersion(entry.APIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry '%s/%s', error: %w", entry.Kind, entry.Name, err)
+		}
+		id := object.ObjMetadata{
+			Namespace: entry.Namespace,
+			Name:      entry.Name,
+			GroupKind: schema.GroupKind{Group: gv.Group, Kind: entry.Kind},
+		}
+		inv.Resources = append(inv.Resources, Resource{
+			ObjectID:      id.String(),
+			ObjectVersion: gv.Version,
+			Status:        entry.Status,
+			Digest:        entry.Digest,
+		})
+	}
+	return inv, nil
+}
+
+func (inv *Inventory) export() (*inventoryExport, error) {
+	resources := make([]Resource, len(inv.Resources))
+	copy(resources, inv.Resources)
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].ObjectID < resources[j].ObjectID
+	})
+
+	export := &inventoryExport{
+		Name:            inv.Name,
+		Namespace:       inv.Namespace,
+		Source:          inv.Source,
+		Revision:        inv.Revision,
+		LastAppliedTime: inv.LastAppliedAt,
+		Metadata:        inv.Metadata,
+		Entries:         make([]entryExport, 0, len(resources)),
+		Artifacts:       inv.Artifacts,
+	}
+	for _, entry := range resources {
+		gvk, key, err := entry.ObjectRef()
+		if err != nil {
+			return nil, err
+		}
+		export.Entries = append(export.Entries, entryExport{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Namespace:  key.Namespace,
+			Name:       key.Name,
+			Status:     entry.Status,
+			Digest:     entry.Digest,
+		})
+	}
+	return export, nil
+}
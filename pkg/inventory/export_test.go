@@ -0,0 +1,94 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInventory_ToYAML(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", []string{"oci://registry/app:1.0.0"})
+	inv.Resources = []Resource{
+		{ObjectID: "default_b_apps_Deployment", ObjectVersion: "v1", Status: ResourceApplied},
+		{ObjectID: "_default__Namespace", ObjectVersion: "v1"},
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+	}
+
+	data, err := inv.ToYAML()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`artifacts:
+- oci://registry/app:1.0.0
+entries:
+- apiVersion: v1
+  kind: Namespace
+  name: default
+- apiVersion: v1
+  kind: ConfigMap
+  name: a
+  namespace: default
+- apiVersion: apps/v1
+  kind: Deployment
+  name: b
+  namespace: default
+  status: Applied
+name: test
+namespace: default
+revision: 1.0.0
+source: oci://registry/app
+`))
+
+	result, err := InventoryFromYAML(data)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Checksum()).To(Equal(inv.Checksum()))
+
+	jsonData, err := inv.ToJSON()
+	g.Expect(err).ToNot(HaveOccurred())
+	result, err = InventoryFromYAML(jsonData)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Resources).To(ConsistOf(inv.Resources))
+}
+
+func TestInventory_ToResourceList(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_b_apps_Deployment", ObjectVersion: "v1", Status: ResourceApplied},
+		{ObjectID: "_default__Namespace", ObjectVersion: "v1"},
+	}
+
+	data, err := inv.ToResourceList()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`apiVersion: v1
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: default
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: b
+    namespace: default
+kind: List
+`))
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	historyKindName = KindName + "-history"
+	historySuffix   = "-history-"
+)
+
+// HistoryEntry describes a previous revision of an inventory.
+type HistoryEntry struct {
+	// Revision is the source revision of the inventory.
+	Revision string
+
+	// Source is the source URL of the inventory.
+	Source string
+
+	// AppliedAt is the time the revision was applied.
+	AppliedAt time.Time
+
+	// Entries is the number of objects recorded in the revision.
+	Entries int
+}
+
+func (s *Storage) historySequenceAnnotation() string {
+	return s.Owner.Group + "/history-sequence"
+}
+
+// historyLabels returns the labels used to select the history of the given inventory.
+func (s *Storage) historyLabels(name, namespace string) client.MatchingLabels {
+	return client.MatchingLabels{
+		s.nameLabel():               name,
+		s.inventoryNamespaceLabel(): namespace,
+		s.componentLabel():          historyKindName,
+		s.createdByLabel():          s.createdBy(),
+	}
+}
+
+// newHistoryObject returns the storage object holding the given revision of the inventory.
+// The object is named after the revision and a hash of the inventory, so that a revision
+// re-applied with different entries doesn't overwrite the previous one, or after the hash
+// alone when the revision can't be part of an object name.
+func (s *Storage) newHistoryObject(i *Inventory) client.Object {
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	sum := sha256.Sum256([]byte(i.Revision + i.Checksum()))
+	hash := fmt.Sprintf("%x", sum)[:10]
+	name := obj.GetName() + historySuffix + i.Revision + "-" + hash
+	if i.Revision == "" || len(validation.IsDNS1123Subdomain(name)) > 0 {
+		name = obj.GetName() + historySuffix + hash
+	}
+	obj.SetName(name)
+
+	s.setObjectKeys(obj, map[string]string{s.componentLabel(): historyKindName})
+	return obj
+}
+
+// previousRevision returns the stored state of the given inventory to be recorded in the history
+// once the inventory is applied, or nil if there is nothing to record.
+func (s *Storage) previousRevision(ctx context.Context, i *Inventory) (*Inventory, error) {
+	current, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		if errors.Is(err, ErrInventoryNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// the empty storage object of a pending creation has no revision
+	if len(getStorageData(current)) == 0 {
+		return nil, nil
+	}
+
+	previous := NewInventory(i.Name, i.Namespace)
+	data, err := s.readData(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decodeInventory(previous, current, data); err != nil {
+		if s.LenientDecoding && errors.Is(err, ErrCorruptInventory) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if previous.Revision == i.Revision && previous.Checksum() == i.Checksum() {
+		return nil, nil
+	}
+	return previous, nil
+}
+
+// recordHistory stores the given previous state of an inventory as a history revision,
+// and removes the oldest revisions exceeding the history limit. It's called after the
+// inventory is applied, so that a failed apply leaves the history untouched.
+func (s *Storage) recordHistory(ctx context.Context, previous *Inventory, patchOpts []client.PatchOption) error {
+	history, err := s.listHistoryObjects(ctx, previous)
+	if err != nil {
+		return err
+	}
+	sequence := 1
+	if len(history) > 0 {
+		sequence = s.historySequence(history[0]) + 1
+	}
+
+	key, resources, err := s.encodeResources(previous.Resources)
+	if err != nil {
+		return err
+	}
+
+	obj := s.newHistoryObject(previous)
+	annotations := s.metaToAnnotations(previous)
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	if previous.LastAppliedAt != "" {
+		annotations[s.Owner.Group+"/last-applied-time"] = previous.LastAppliedAt
+	}
+	if s.Encryptor != nil {
+		annotations[s.encryptedAnnotation()] = "true"
+	}
+	if err := s.sign(obj, annotations, resources); err != nil {
+		return err
+	}
+	annotations[s.historySequenceAnnotation()] = strconv.Itoa(sequence)
+	obj.SetAnnotations(annotations)
+
+	data := map[string]string{key: resources}
+	if len(previous.Artifacts) > 0 {
+		artifacts, err := s.codec().Marshal(previous.Artifacts)
+		if err != nil {
+			return err
+		}
+		data[artifactsKey] = string(artifacts)
+	}
+	if err := s.applyHistoryObject(ctx, obj, key, data, patchOpts); err != nil {
+		return err
+	}
+
+	history, err = s.listHistoryObjects(ctx, previous)
+	if err != nil {
+		return err
+	}
+	for n := s.HistoryLimit; n < len(history); n++ {
+		if err := s.deleteHistoryObject(ctx, history[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyHistoryObject writes the given history object with the given data, the payload stored
+// under key is split into shards when it exceeds the size limit.
+func (s *Storage) applyHistoryObject(ctx context.Context, obj client.Object, key string, data map[string]string, patchOpts []client.PatchOption) error {
+	chunks := splitPayload(data[key], s.maxBytes())
+
+	annotations := make(map[string]string, len(obj.GetAnnotations())+2)
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	delete(annotations, s.shardsAnnotation())
+	delete(annotations, s.shardsIDAnnotation())
+	id := ""
+	if len(chunks) > 1 {
+		id = shardsID(data[key])
+		annotations[s.shardsAnnotation()] = strconv.Itoa(len(chunks))
+		annotations[s.shardsIDAnnotation()] = id
+	}
+	obj.SetAnnotations(annotations)
+
+	objData := make(map[string]string, len(data))
+	for k, v := range data {
+		objData[k] = v
+	}
+	objData[key] = chunks[0]
+	setStorageData(obj, objData)
+
+	if err := s.applyShards(ctx, obj, id, key, chunks[1:], false, patchOpts); err != nil {
+		return err
+	}
+	if err := s.patchStorageObject(ctx, obj, false, patchOpts); err != nil {
+		return fmt.Errorf("failed to apply %s/%s, error: %w", s.backendKind(), client.ObjectKeyFromObject(obj), err)
+	}
+	return s.pruneShards(ctx, obj, id)
+}
+
+// deleteHistoryObject removes the given history object and its shards.
+func (s *Storage) deleteHistoryObject(ctx context.Context, obj client.Object) error {
+	if err := s.client().Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s/%s, error: %w", s.backendKind(), client.ObjectKeyFromObject(obj), err)
+	}
+	return s.pruneShards(ctx, obj, "")
+}
+
+// historySequence returns the sequence number of the given history object.
+func (s *Storage) historySequence(obj client.Object) int {
+	sequence, _ := strconv.Atoi(obj.GetAnnotations()[s.historySequenceAnnotation()])
+	return sequence
+}
+
+// listHistoryObjects returns the history objects of the given inventory, newest first.
+func (s *Storage) listHistoryObjects(ctx context.Context, i *Inventory) ([]client.Object, error) {
+	objects, err := s.listStorageObjects(ctx, s.storageNamespace(i.Name, i.Namespace), s.historyLabels(i.Name, i.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(objects, func(a, b int) bool {
+		return s.historySequence(objects[a]) > s.historySequence(objects[b])
+	})
+	return objects, nil
+}
+
+// ListHistory returns the previous revisions of the given inventory, newest first.
+func (s *Storage) ListHistory(ctx context.Context, i *Inventory) ([]HistoryEntry, error) {
+	objects, err := s.listHistoryObjects(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(objects))
+	for _, obj := range objects {
+		revision := NewInventory(i.Name, i.Namespace)
+		s.metaFromAnnotations(revision, obj.GetAnnotations())
+		entries = append(entries, HistoryEntry{
+			Revision:  revision.Revision,
+			Source:    revision.Source,
+			AppliedAt: revision.LastAppliedTime(),
+			Entries:   revision.Count,
+		})
+	}
+	return entries, nil
+}
+
+// RestoreRevision replaces the entries, source and artifacts of the given inventory with the
+// ones recorded for the given revision, and applies the inventory. The state being replaced
+// is recorded in the history, the attachments and expiry of the stored inventory are kept.
+func (s *Storage) RestoreRevision(ctx context.Context, i *Inventory, revision string) error {
+	opts, err := s.getInventory(ctx, NewInventory(i.Name, i.Namespace))
+	if err != nil && !errors.Is(err, ErrInventoryNotFound) {
+		return err
+	}
+
+	objects, err := s.listHistoryObjects(ctx, i)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		previous := NewInventory(i.Name, i.Namespace)
+		s.metaFromAnnotations(previous, obj.GetAnnotations())
+		if previous.Revision != revision {
+			continue
+		}
+
+		data, err := s.readData(ctx, obj)
+		if err != nil {
+			return err
+		}
+		if err := s.decodeInventory(previous, obj, data); err != nil {
+			return err
+		}
+		i.Source = previous.Source
+		i.Revision = previous.Revision
+		i.Resources = previous.Resources
+		i.Artifacts = previous.Artifacts
+		i.Metadata = previous.Metadata
+		_, err = s.ApplyInventory(ctx, i, opts)
+		return err
+	}
+
+	return newNotFoundError(fmt.Errorf("revision '%s' not found in the history of %s/%s", revision, i.Namespace, i.Name))
+}
+
+// deleteHistory removes all the history objects of the given inventory and their shards.
+func (s *Storage) deleteHistory(ctx context.Context, i *Inventory) error {
+	objects, err := s.listHistoryObjects(ctx, i)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.deleteHistoryObject(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
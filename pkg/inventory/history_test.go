@@ -0,0 +1,140 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_History(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 2
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	for n := 1; n <= 4; n++ {
+		inv.SetSource("oci://registry/app", fmt.Sprintf("1.0.%d", n), nil)
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	history, err := s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(2))
+	g.Expect(history[0].Revision).To(Equal("1.0.3"))
+	g.Expect(history[0].Entries).To(Equal(3))
+	g.Expect(history[1].Revision).To(Equal("1.0.2"))
+
+	g.Expect(s.RestoreRevision(ctx, inv, "1.0.2")).To(Succeed())
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Revision).To(Equal("1.0.2"))
+	g.Expect(result.Resources).To(HaveLen(2))
+
+	history, err = s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history[0].Revision).To(Equal("1.0.4"))
+
+	err = s.RestoreRevision(ctx, inv, "1.0.1")
+	g.Expect(err).To(MatchError(ErrInventoryNotFound))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	history, err = s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(BeEmpty())
+}
+
+func TestStorage_HistoryShards(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 2
+	s.MaxBytes = 1024
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	for n := 0; n < 100; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+	}
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	inv.SetSource("oci://registry/app", "1.0.1", nil)
+	inv.Resources = inv.Resources[:1]
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	g.Expect(s.RestoreRevision(ctx, inv, "1.0.0")).To(Succeed())
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(HaveLen(100))
+
+	history, err := s.listHistoryObjects(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(2))
+	shards, err := s.listShards(ctx, history[1])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(shards).ToNot(BeEmpty())
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	shards, err = s.listShards(ctx, history[1])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(shards).To(BeEmpty())
+}
+
+func TestStorage_HistoryConflict(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 2
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	inv.SetSource("oci://registry/app", "1.0.1", nil)
+	inv.ResourceVersion = "999"
+	_, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(errors.Is(err, ErrInventoryConflict)).To(BeTrue())
+
+	history, err := s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(BeEmpty())
+}
+
+func TestStorage_HistorySameRevision(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 3
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	for n := 1; n <= 3; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	history, err := s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(2))
+	g.Expect(history[0].Entries).To(Equal(2))
+	g.Expect(history[1].Entries).To(Equal(1))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// InactiveFilter selects the inventories listed by their inactive state.
+type InactiveFilter int
+
+const (
+	// IncludeInactive lists both the active and inactive inventories.
+	IncludeInactive InactiveFilter = iota
+
+	// ExcludeInactive lists only the active inventories.
+	ExcludeInactive
+
+	// OnlyInactive lists only the inactive inventories.
+	OnlyInactive
+)
+
+// ListOptions contains options for ListInventories and ListInventoriesMeta.
+type ListOptions struct {
+	// Inactive selects the inventories by their inactive state, defaults to IncludeInactive.
+	Inactive InactiveFilter
+}
+
+// listOptions returns the first of the given options, or the default options.
+func listOptions(opts []ListOptions) ListOptions {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return ListOptions{}
+}
+
+// filter returns the given inventories selected by the options.
+func (o ListOptions) filter(inventories []*Inventory) []*Inventory {
+	if o.Inactive == IncludeInactive {
+		return inventories
+	}
+
+	var result []*Inventory
+	for _, i := range inventories {
+		if i.Inactive == (o.Inactive == OnlyInactive) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// inactiveAnnotation returns the annotation flagging an inactive inventory.
+func (s *Storage) inactiveAnnotation() string {
+	return s.Owner.Group + "/inactive"
+}
+
+// inactiveSinceAnnotation returns the annotation holding the time an inventory was deactivated.
+func (s *Storage) inactiveSinceAnnotation() string {
+	return s.Owner.Group + "/inactive-since"
+}
+
+// DeactivateInventory marks the stored inventory as inactive, keeping its entries, so that it
+// can be restored with ActivateInventory or deleted after a grace period. Deactivating an inactive
+// inventory keeps its original inactivation time. Applying an inactive inventory activates it.
+func (s *Storage) DeactivateInventory(ctx context.Context, i *Inventory) error {
+	stored := NewInventory(i.Name, i.Namespace)
+	if err := s.GetInventoryMeta(ctx, stored); err != nil {
+		return err
+	}
+	if stored.Inactive {
+		i.Inactive = true
+		i.InactiveSince = stored.InactiveSince
+		return nil
+	}
+
+	inactiveSince := s.now().UTC().Format(time.RFC3339)
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	err := s.patchAnnotations(ctx, obj, map[string]interface{}{
+		s.inactiveAnnotation():      "true",
+		s.inactiveSinceAnnotation(): inactiveSince,
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+	i.Inactive = true
+	i.InactiveSince = inactiveSince
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// ActivateInventory removes the inactive mark of the stored inventory.
+func (s *Storage) ActivateInventory(ctx context.Context, i *Inventory) error {
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	err := s.clearAnnotations(ctx, obj, []string{s.inactiveAnnotation(), s.inactiveSinceAnnotation()})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+	i.Inactive = false
+	i.InactiveSince = ""
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
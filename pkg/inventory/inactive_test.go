@@ -0,0 +1,82 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_DeactivateInventory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	now := time.Date(2021, 11, 5, 10, 30, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b"} {
+		inv := NewInventory(name, "default")
+		inv.Resources = []Resource{{ObjectID: "default_" + name + "__ConfigMap", ObjectVersion: "v1"}}
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	g.Expect(s.DeactivateInventory(ctx, NewInventory("a", "default"))).To(Succeed())
+	now = now.Add(time.Hour)
+	g.Expect(s.DeactivateInventory(ctx, NewInventory("a", "default"))).To(Succeed())
+	g.Expect(s.DeactivateInventory(ctx, NewInventory("missing", "default"))).To(MatchError(ErrInventoryNotFound))
+
+	stored := NewInventory("a", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Inactive).To(BeTrue())
+	g.Expect(stored.InactiveSince).To(Equal("2021-11-05T10:30:00Z"))
+	g.Expect(stored.Resources).To(HaveLen(1))
+	g.Expect(stored.Metadata).To(BeEmpty())
+
+	names := func(inventories []*Inventory) []string {
+		var result []string
+		for _, i := range inventories {
+			result = append(result, i.Name)
+		}
+		return result
+	}
+	all, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(names(all)).To(ConsistOf("a", "b"))
+	active, err := s.ListInventories(ctx, "default", ListOptions{Inactive: ExcludeInactive})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(names(active)).To(ConsistOf("b"))
+	inactive, err := s.ListInventoriesMeta(ctx, "default", ListOptions{Inactive: OnlyInactive})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(names(inactive)).To(ConsistOf("a"))
+
+	g.Expect(s.ActivateInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Inactive).To(BeFalse())
+	activated := NewInventory("a", "default")
+	g.Expect(s.GetInventory(ctx, activated)).To(Succeed())
+	g.Expect(activated.Inactive).To(BeFalse())
+	g.Expect(activated.InactiveSince).To(BeEmpty())
+
+	g.Expect(s.DeactivateInventory(ctx, stored)).To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, stored, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(stored.Inactive).To(BeFalse())
+	applied := NewInventory("a", "default")
+	g.Expect(s.GetInventory(ctx, applied)).To(Succeed())
+	g.Expect(applied.Inactive).To(BeFalse())
+}
@@ -17,12 +17,17 @@ limitations under the License.
 package inventory
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"sort"
+	"time"
 
 	"github.com/fluxcd/pkg/ssa"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // Inventory is a record of objects that are applied on a cluster stored as a configmap.
@@ -42,11 +47,39 @@ type Inventory struct {
 	// LastAppliedAt is the timestamp (UTC RFC3339) of the last successful apply.
 	LastAppliedAt string `json:"lastAppliedTime,omitempty"`
 
+	// LastAppliedChecksum is the checksum of the entries recorded at the last successful apply.
+	LastAppliedChecksum string `json:"lastAppliedChecksum,omitempty"`
+
+	// ResourceVersion is the resource version of the storage object, when set
+	// the inventory is applied only if the storage object wasn't modified since.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// ExpiresAt is the timestamp (UTC RFC3339) after which the inventory is expired,
+	// empty for inventories applied without a TTL.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	// Inactive is true if the inventory was deactivated.
+	Inactive bool `json:"inactive,omitempty"`
+
+	// InactiveSince is the timestamp (UTC RFC3339) when the inventory was deactivated.
+	InactiveSince string `json:"inactiveSince,omitempty"`
+
+	// AppliedByVersion is the version of the tool that performed the last successful apply.
+	AppliedByVersion string `json:"appliedByVersion,omitempty"`
+
+	// Count is the number of entries recorded at the last successful apply.
+	Count int `json:"count,omitempty"`
+
 	// Resources is the list of Kubernetes object IDs.
 	Resources []Resource `json:"resources"`
 
 	// Artifacts is the list of the OCI URLs.
 	Artifacts []string `json:"artifacts"`
+
+	// Metadata is free-form deployment context, e.g. the commit author or the CI build URL,
+	// stored as annotations prefixed with '<group>/meta.'. Other annotations of the owner group
+	// not managed by the storage are kept under their full key.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // Resource contains the information necessary to locate the Kubernetes object.
@@ -57,8 +90,29 @@ type Resource struct {
 
 	// ObjectVersion is the API version of this entry kind.
 	ObjectVersion string `json:"ver"`
+
+	// Status is the apply status of this entry, empty for inventories recorded without status tracking.
+	Status ResourceStatus `json:"status,omitempty"`
+
+	// Digest is the SHA256 checksum of the fields applied to the object, as returned by
+	// ManagedObjectDigest, empty for inventories recorded without digests.
+	Digest string `json:"digest,omitempty"`
 }
 
+// ResourceStatus is the apply status of an inventory entry.
+type ResourceStatus string
+
+const (
+	// ResourceApplied means the object was applied on the cluster.
+	ResourceApplied ResourceStatus = "Applied"
+
+	// ResourcePending means the object wasn't applied yet.
+	ResourcePending ResourceStatus = "Pending"
+
+	// ResourceFailed means the object apply failed.
+	ResourceFailed ResourceStatus = "Failed"
+)
+
 func NewInventory(name, namespace string) *Inventory {
 	return &Inventory{
 		Name:      name,
@@ -67,6 +121,30 @@ func NewInventory(name, namespace string) *Inventory {
 	}
 }
 
+// DeepCopy returns an independent copy of the inventory, including its entries, artifacts and metadata.
+func (inv *Inventory) DeepCopy() *Inventory {
+	if inv == nil {
+		return nil
+	}
+
+	out := *inv
+	if inv.Resources != nil {
+		out.Resources = make([]Resource, len(inv.Resources))
+		copy(out.Resources, inv.Resources)
+	}
+	if inv.Artifacts != nil {
+		out.Artifacts = make([]string, len(inv.Artifacts))
+		copy(out.Artifacts, inv.Artifacts)
+	}
+	if inv.Metadata != nil {
+		out.Metadata = make(map[string]string, len(inv.Metadata))
+		for k, v := range inv.Metadata {
+			out.Metadata[k] = v
+		}
+	}
+	return &out
+}
+
 // SetSource sets the source url and revision for this inventory.
 func (inv *Inventory) SetSource(url, revision string, artifacts []string) {
 	inv.Source = url
@@ -74,6 +152,46 @@ func (inv *Inventory) SetSource(url, revision string, artifacts []string) {
 	inv.Artifacts = artifacts
 }
 
+// LastAppliedTime returns the parsed timestamp of the last successful apply.
+// It returns the zero time if the timestamp is missing or invalid.
+func (inv *Inventory) LastAppliedTime() time.Time {
+	t, err := time.Parse(time.RFC3339, inv.LastAppliedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// IsExpired returns true if the inventory has an expiry time in the past.
+func (inv *Inventory) IsExpired() bool {
+	return inv.expiredAt(time.Now())
+}
+
+func (inv *Inventory) expiredAt(now time.Time) bool {
+	if inv.ExpiresAt == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, inv.ExpiresAt)
+	return err == nil && !now.Before(t)
+}
+
+// Checksum returns the SHA256 checksum of the inventory entries.
+// The checksum doesn't depend on the order of the entries.
+func (inv *Inventory) Checksum() string {
+	ids := make([]string, 0, len(inv.Resources))
+	for _, entry := range inv.Resources {
+		ids = append(ids, entry.ObjectID+"@"+entry.ObjectVersion)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 // AddObjects extracts the metadata from the given objects and adds it to the inventory.
 func (inv *Inventory) AddObjects(objects []*unstructured.Unstructured) error {
 	sort.Sort(ssa.SortableUnstructureds(objects))
@@ -93,6 +211,29 @@ func (inv *Inventory) AddObjects(objects []*unstructured.Unstructured) error {
 	return nil
 }
 
+// ResourceFromObject returns the inventory entry of the given object.
+func ResourceFromObject(obj *unstructured.Unstructured) Resource {
+	return Resource{
+		ObjectID:      object.UnstructuredToObjMetadata(obj).String(),
+		ObjectVersion: obj.GroupVersionKind().Version,
+	}
+}
+
+// ObjectRef returns the kind and the key of the object recorded by this entry.
+func (r Resource) ObjectRef() (schema.GroupVersionKind, client.ObjectKey, error) {
+	objMetadata, err := object.ParseObjMetadata(r.ObjectID)
+	if err != nil {
+		return schema.GroupVersionKind{}, client.ObjectKey{}, err
+	}
+
+	gvk := schema.GroupVersionKind{
+		Group:   objMetadata.GroupKind.Group,
+		Kind:    objMetadata.GroupKind.Kind,
+		Version: r.ObjectVersion,
+	}
+	return gvk, client.ObjectKey{Namespace: objMetadata.Namespace, Name: objMetadata.Name}, nil
+}
+
 // VersionOf returns the API version of the given object if found in this inventory.
 func (inv *Inventory) VersionOf(objMetadata object.ObjMetadata) string {
 	for _, entry := range inv.Resources {
@@ -103,24 +244,61 @@ func (inv *Inventory) VersionOf(objMetadata object.ObjMetadata) string {
 	return ""
 }
 
+// FindEntry returns the entry of the object with the given kind, name and namespace if found in this inventory.
+// The lookup matches the object identity, the version of the given kind is ignored.
+func (inv *Inventory) FindEntry(gvk schema.GroupVersionKind, name, namespace string) (Resource, bool) {
+	id := object.ObjMetadata{
+		Namespace: namespace,
+		Name:      name,
+		GroupKind: gvk.GroupKind(),
+	}.String()
+	for _, entry := range inv.Resources {
+		if entry.ObjectID == id {
+			return entry, true
+		}
+	}
+	return Resource{}, false
+}
+
+// SetObjectStatus sets the apply status of the given object if found in this inventory.
+func (inv *Inventory) SetObjectStatus(obj *unstructured.Unstructured, status ResourceStatus) {
+	id := object.UnstructuredToObjMetadata(obj).String()
+	for n := range inv.Resources {
+		if inv.Resources[n].ObjectID == id {
+			inv.Resources[n].Status = status
+		}
+	}
+}
+
 // ListObjects returns the inventory entries as unstructured.Unstructured objects.
 func (inv *Inventory) ListObjects() ([]*unstructured.Unstructured, error) {
-	objects := make([]*unstructured.Unstructured, 0)
+	return listObjects(inv.Resources)
+}
 
+// ListObjectsWithStatus returns the inventory entries with the given apply status as unstructured.Unstructured objects.
+func (inv *Inventory) ListObjectsWithStatus(status ResourceStatus) ([]*unstructured.Unstructured, error) {
+	var entries []Resource
 	for _, entry := range inv.Resources {
-		objMetadata, err := object.ParseObjMetadata(entry.ObjectID)
+		if entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	return listObjects(entries)
+}
+
+func listObjects(entries []Resource) ([]*unstructured.Unstructured, error) {
+	objects := make([]*unstructured.Unstructured, 0)
+
+	for _, entry := range entries {
+		gvk, key, err := entry.ObjectRef()
 		if err != nil {
 			return nil, err
 		}
 
 		u := &unstructured.Unstructured{}
-		u.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   objMetadata.GroupKind.Group,
-			Kind:    objMetadata.GroupKind.Kind,
-			Version: entry.ObjectVersion,
-		})
-		u.SetName(objMetadata.Name)
-		u.SetNamespace(objMetadata.Namespace)
+		u.SetGroupVersionKind(gvk)
+		u.SetName(key.Name)
+		u.SetNamespace(key.Namespace)
 		objects = append(objects, u)
 	}
 
@@ -142,8 +320,53 @@ func (inv *Inventory) ListMeta() (object.ObjMetadataSet, error) {
 	return metas, nil
 }
 
+// CountByGroupKind returns the number of inventory entries for each object GroupKind,
+// entries with an invalid object ID are not counted.
+func (inv *Inventory) CountByGroupKind() map[schema.GroupKind]int {
+	counts := make(map[schema.GroupKind]int)
+	for _, e := range inv.Resources {
+		m, err := object.ParseObjMetadata(e.ObjectID)
+		if err != nil {
+			continue
+		}
+		counts[m.GroupKind]++
+	}
+	return counts
+}
+
+// GroupVersionKinds returns the distinct GroupVersionKinds of the inventory entries sorted by group,
+// kind and version, entries with an invalid object ID are skipped.
+func (inv *Inventory) GroupVersionKinds() []schema.GroupVersionKind {
+	seen := make(map[schema.GroupVersionKind]bool)
+	var gvks []schema.GroupVersionKind
+	for _, e := range inv.Resources {
+		gvk, _, err := e.ObjectRef()
+		if err != nil || seen[gvk] {
+			continue
+		}
+		seen[gvk] = true
+		gvks = append(gvks, gvk)
+	}
+
+	sort.Slice(gvks, func(i, j int) bool {
+		if gvks[i].Group != gvks[j].Group {
+			return gvks[i].Group < gvks[j].Group
+		}
+		if gvks[i].Kind != gvks[j].Kind {
+			return gvks[i].Kind < gvks[j].Kind
+		}
+		return gvks[i].Version < gvks[j].Version
+	})
+	return gvks
+}
+
 // Diff returns the slice of objects that do not exist in the target inventory.
 func (inv *Inventory) Diff(target *Inventory) ([]*unstructured.Unstructured, error) {
+	return inv.diff(target, nil)
+}
+
+// diff implements Diff, calling the optional progress function after each entry is compared.
+func (inv *Inventory) diff(target *Inventory, progress ProgressFunc) ([]*unstructured.Unstructured, error) {
 	objects := make([]*unstructured.Unstructured, 0)
 	aList, err := inv.ListMeta()
 	if err != nil {
@@ -155,23 +378,235 @@ func (inv *Inventory) Diff(target *Inventory) ([]*unstructured.Unstructured, err
 		return nil, err
 	}
 
-	list := aList.Diff(bList)
-	if len(list) == 0 {
-		return objects, nil
+	skip := make(map[object.ObjMetadata]bool, len(bList))
+	for _, metadata := range bList {
+		skip[metadata] = true
 	}
 
-	for _, metadata := range list {
-		u := &unstructured.Unstructured{}
-		u.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   metadata.GroupKind.Group,
-			Kind:    metadata.GroupKind.Kind,
-			Version: inv.VersionOf(metadata),
-		})
-		u.SetName(metadata.Name)
-		u.SetNamespace(metadata.Namespace)
-		objects = append(objects, u)
+	for n, metadata := range aList {
+		if !skip[metadata] {
+			skip[metadata] = true
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   metadata.GroupKind.Group,
+				Kind:    metadata.GroupKind.Kind,
+				Version: inv.VersionOf(metadata),
+			})
+			u.SetName(metadata.Name)
+			u.SetNamespace(metadata.Namespace)
+			objects = append(objects, u)
+		}
+		if progress != nil {
+			progress(n+1, len(aList))
+		}
 	}
 
 	sort.Sort(ssa.SortableUnstructureds(objects))
 	return objects, nil
 }
+
+// DiffFrom compares this inventory with a previous one and returns the objects
+// that were added to and the objects that were removed from the previous inventory.
+func (inv *Inventory) DiffFrom(previous *Inventory) (added []*unstructured.Unstructured, removed []*unstructured.Unstructured, err error) {
+	added, err = inv.Diff(previous)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removed, err = previous.Diff(inv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return added, removed, nil
+}
+
+// DiffResult contains the entries of an inventory compared to a previous one.
+type DiffResult struct {
+	// Created are the entries not present in the previous inventory.
+	Created []Resource
+
+	// Unchanged are the entries present in both inventories.
+	Unchanged []Resource
+
+	// Deleted are the entries of the previous inventory no longer present.
+	Deleted []Resource
+}
+
+// FullDiff compares the entries of this inventory with the previous one,
+// the entries of each category are sorted by object ID.
+func (inv *Inventory) FullDiff(previous *Inventory) *DiffResult {
+	result := &DiffResult{}
+
+	current := make(map[string]bool, len(inv.Resources))
+	for _, entry := range inv.Resources {
+		current[entry.ObjectID] = true
+	}
+	existing := make(map[string]bool, len(previous.Resources))
+	for _, entry := range previous.Resources {
+		existing[entry.ObjectID] = true
+		if !current[entry.ObjectID] {
+			result.Deleted = append(result.Deleted, entry)
+		}
+	}
+	for _, entry := range inv.Resources {
+		if existing[entry.ObjectID] {
+			result.Unchanged = append(result.Unchanged, entry)
+		} else {
+			result.Created = append(result.Created, entry)
+		}
+	}
+
+	for _, entries := range [][]Resource{result.Created, result.Unchanged, result.Deleted} {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].ObjectID < entries[j].ObjectID
+		})
+	}
+	return result
+}
+
+// MetadataChangedFrom returns true if the source, revision, artifacts or metadata
+// of this inventory differ from the given one, regardless of the entries.
+func (inv *Inventory) MetadataChangedFrom(other *Inventory) bool {
+	return len(inv.MetadataDiff(other)) > 0
+}
+
+// MetadataDiff returns the sorted names of the fields that differ between this inventory and the given one,
+// among 'source', 'revision', 'artifacts' and 'metadata.<key>' for each differing metadata key.
+func (inv *Inventory) MetadataDiff(other *Inventory) []string {
+	var fields []string
+	if inv.Source != other.Source {
+		fields = append(fields, "source")
+	}
+	if inv.Revision != other.Revision {
+		fields = append(fields, "revision")
+	}
+
+	artifactsChanged := len(inv.Artifacts) != len(other.Artifacts)
+	for n := 0; !artifactsChanged && n < len(inv.Artifacts); n++ {
+		artifactsChanged = inv.Artifacts[n] != other.Artifacts[n]
+	}
+	if artifactsChanged {
+		fields = append(fields, "artifacts")
+	}
+
+	for k, v := range inv.Metadata {
+		if ov, ok := other.Metadata[k]; !ok || ov != v {
+			fields = append(fields, "metadata."+k)
+		}
+	}
+	for k := range other.Metadata {
+		if _, ok := inv.Metadata[k]; !ok {
+			fields = append(fields, "metadata."+k)
+		}
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+// Equal returns true if this inventory and the given one have the same name, namespace, source,
+// revision, artifacts and metadata, and the same set of entries regardless of their order and
+// duplicates. Entries are compared on all their fields, i.e. object ID, version, status and digest.
+// The fields set by the storage, such as the last applied time, resource version, count, checksum,
+// expiry and inactive state, are ignored.
+func (inv *Inventory) Equal(other *Inventory) bool {
+	if other == nil || inv.Name != other.Name || inv.Namespace != other.Namespace {
+		return false
+	}
+	if inv.MetadataChangedFrom(other) {
+		return false
+	}
+
+	entries := make(map[Resource]bool, len(inv.Resources))
+	for _, entry := range inv.Resources {
+		entries[entry] = true
+	}
+	otherEntries := make(map[Resource]bool, len(other.Resources))
+	for _, entry := range other.Resources {
+		if !entries[entry] {
+			return false
+		}
+		otherEntries[entry] = true
+	}
+	return len(entries) == len(otherEntries)
+}
+
+// Merge adds the entries and artifacts of the given inventories to this inventory.
+// Entries are deduplicated by object ID, and an error is returned if the same object
+// is recorded with different API versions, in which case this inventory is left unchanged.
+func (inv *Inventory) Merge(others ...*Inventory) error {
+	resources := append([]Resource{}, inv.Resources...)
+	index := make(map[string]int, len(resources))
+	for n, entry := range resources {
+		index[entry.ObjectID] = n
+	}
+
+	artifacts := append([]string{}, inv.Artifacts...)
+	seen := make(map[string]bool, len(artifacts))
+	for _, artifact := range artifacts {
+		seen[artifact] = true
+	}
+
+	for _, other := range others {
+		for _, entry := range other.Resources {
+			if n, ok := index[entry.ObjectID]; ok {
+				if resources[n].ObjectVersion != entry.ObjectVersion {
+					return fmt.Errorf("conflicting versions %s and %s for object %s in inventory %s/%s",
+						resources[n].ObjectVersion, entry.ObjectVersion, entry.ObjectID, other.Namespace, other.Name)
+				}
+				continue
+			}
+			index[entry.ObjectID] = len(resources)
+			resources = append(resources, entry)
+		}
+
+		for _, artifact := range other.Artifacts {
+			if !seen[artifact] {
+				seen[artifact] = true
+				artifacts = append(artifacts, artifact)
+			}
+		}
+	}
+
+	inv.Resources = resources
+	if len(artifacts) > 0 {
+		inv.Artifacts = artifacts
+	}
+	return nil
+}
+
+// ScopeFunc reports whether the objects of the given kind are namespaced.
+type ScopeFunc func(gk schema.GroupKind) (bool, error)
+
+// Validate checks that each entry has a version, kind and name. If a scope function is given,
+// the entries of namespaced kinds are also checked to have a namespace.
+// The returned error lists all the invalid entries.
+func (inv *Inventory) Validate(isNamespaced ScopeFunc) error {
+	var errs []error
+	for _, entry := range inv.Resources {
+		objMetadata, err := object.ParseObjMetadata(entry.ObjectID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid entry '%s': %w", entry.ObjectID, err))
+			continue
+		}
+
+		switch {
+		case entry.ObjectVersion == "":
+			errs = append(errs, fmt.Errorf("invalid entry '%s': version is empty", entry.ObjectID))
+		case objMetadata.GroupKind.Kind == "":
+			errs = append(errs, fmt.Errorf("invalid entry '%s': kind is empty", entry.ObjectID))
+		case objMetadata.Name == "":
+			errs = append(errs, fmt.Errorf("invalid entry '%s': name is empty", entry.ObjectID))
+		case objMetadata.Namespace == "" && isNamespaced != nil:
+			namespaced, err := isNamespaced(objMetadata.GroupKind)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid entry '%s': %w", entry.ObjectID, err))
+			} else if namespaced {
+				errs = append(errs, fmt.Errorf("invalid entry '%s': namespace is empty", entry.ObjectID))
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,322 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInventory_Checksum(t *testing.T) {
+	g := NewWithT(t)
+
+	a := NewInventory("test", "default")
+	a.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}
+
+	b := NewInventory("test", "default")
+	b.Resources = []Resource{a.Resources[1], a.Resources[0]}
+	g.Expect(b.Checksum()).To(Equal(a.Checksum()))
+
+	b.Resources[0].ObjectVersion = "v2"
+	g.Expect(b.Checksum()).NotTo(Equal(a.Checksum()))
+}
+
+func TestInventory_DiffFrom(t *testing.T) {
+	g := NewWithT(t)
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__ConfigMap", ObjectVersion: "v1"},
+	}
+
+	current := NewInventory("test", "default")
+	current.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}
+
+	added, removed, err := current.DiffFrom(previous)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(added).To(HaveLen(1))
+	g.Expect(added[0].GetKind()).To(Equal("Service"))
+	g.Expect(removed).To(HaveLen(1))
+	g.Expect(removed[0].GetKind()).To(Equal("ConfigMap"))
+}
+
+func TestInventory_FullDiff(t *testing.T) {
+	g := NewWithT(t)
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__ConfigMap", ObjectVersion: "v1"},
+	}
+
+	current := NewInventory("test", "default")
+	current.Resources = []Resource{
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Secret", ObjectVersion: "v1"},
+	}
+
+	result := current.FullDiff(previous)
+	g.Expect(result.Created).To(Equal([]Resource{
+		{ObjectID: "default_app__Secret", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}))
+	g.Expect(result.Unchanged).To(Equal([]Resource{{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"}}))
+	g.Expect(result.Deleted).To(Equal([]Resource{{ObjectID: "default_app__ConfigMap", ObjectVersion: "v1"}}))
+}
+
+func TestInventory_DeepCopy(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", []string{"oci://registry/app:1.0.0"})
+	inv.Metadata = map[string]string{"author": "dev"}
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+
+	clone := inv.DeepCopy()
+	g.Expect(clone).To(Equal(inv))
+
+	clone.Resources[0].ObjectVersion = "v2"
+	clone.Artifacts[0] = "oci://registry/app:2.0.0"
+	clone.Metadata["author"] = "ops"
+	g.Expect(inv.Resources[0].ObjectVersion).To(Equal("v1"))
+	g.Expect(inv.Artifacts[0]).To(Equal("oci://registry/app:1.0.0"))
+	g.Expect(inv.Metadata["author"]).To(Equal("dev"))
+}
+
+func TestInventory_ObjectStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}
+	checksum := inv.Checksum()
+
+	objects, err := inv.ListObjects()
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, obj := range objects {
+		inv.SetObjectStatus(obj, ResourceApplied)
+	}
+	inv.SetObjectStatus(objects[0], ResourceFailed)
+
+	failed, err := inv.ListObjectsWithStatus(ResourceFailed)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(failed).To(HaveLen(1))
+	g.Expect(failed[0].GetName()).To(Equal(objects[0].GetName()))
+	g.Expect(failed[0].GetKind()).To(Equal(objects[0].GetKind()))
+
+	stale, err := inv.Diff(&Inventory{Resources: []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stale).To(BeEmpty())
+	g.Expect(inv.Checksum()).To(Equal(checksum))
+}
+
+func TestInventory_Merge(t *testing.T) {
+	g := NewWithT(t)
+
+	a := NewInventory("a", "default")
+	a.Resources = []Resource{{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"}}
+
+	b := NewInventory("b", "default")
+	b.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+	}
+
+	merged := NewInventory("merged", "default")
+	g.Expect(merged.Merge(a, b)).To(Succeed())
+	g.Expect(merged.Resources).To(HaveLen(2))
+
+	c := NewInventory("c", "default")
+	c.Resources = []Resource{{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v2"}}
+	g.Expect(merged.Merge(c)).NotTo(Succeed())
+	g.Expect(merged.Resources).To(HaveLen(2))
+}
+
+func TestInventory_Validate(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "_app__Namespace", ObjectVersion: "v1"},
+		{ObjectID: "default__apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: ""},
+	}
+
+	isNamespaced := func(gk schema.GroupKind) (bool, error) {
+		return gk.Kind != "Namespace", nil
+	}
+
+	err := inv.Validate(isNamespaced)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("'_app_apps_Deployment': namespace is empty"))
+	g.Expect(err.Error()).To(ContainSubstring("'default__apps_Deployment': name is empty"))
+	g.Expect(err.Error()).To(ContainSubstring("'default_app__Service': version is empty"))
+	g.Expect(err.Error()).NotTo(ContainSubstring("Namespace"))
+
+	g.Expect(inv.Validate(nil).Error()).NotTo(ContainSubstring("namespace is empty"))
+}
+
+func TestResource_ObjectRef(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetNamespace("default")
+	obj.SetName("app")
+
+	entry := ResourceFromObject(obj)
+	g.Expect(entry).To(Equal(Resource{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"}))
+
+	gvk, key, err := entry.ObjectRef()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gvk).To(Equal(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+	g.Expect(key).To(Equal(client.ObjectKey{Namespace: "default", Name: "app"}))
+
+	_, _, err = Resource{ObjectID: "invalid"}.ObjectRef()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestInventory_MetadataDiff(t *testing.T) {
+	g := NewWithT(t)
+
+	stored := NewInventory("test", "default")
+	stored.SetSource("oci://registry/app", "1.0.0", []string{"oci://registry/app:1.0.0"})
+	stored.Metadata = map[string]string{"author": "dev@example.com", "build": "1"}
+	stored.Resources = []Resource{{ObjectID: "default_app__Service", ObjectVersion: "v1"}}
+
+	desired := stored.DeepCopy()
+	desired.Resources = nil
+	g.Expect(desired.MetadataChangedFrom(stored)).To(BeFalse())
+	g.Expect(desired.MetadataDiff(stored)).To(BeEmpty())
+
+	desired.SetSource("oci://registry/app", "1.0.1", []string{"oci://registry/app:1.0.1"})
+	desired.Metadata = map[string]string{"author": "dev@example.com", "commit": "abc"}
+	g.Expect(desired.MetadataChangedFrom(stored)).To(BeTrue())
+	g.Expect(desired.MetadataDiff(stored)).To(Equal([]string{"artifacts", "metadata.build", "metadata.commit", "revision"}))
+}
+
+func TestInventory_CountByGroupKind(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_web_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+		{ObjectID: "invalid", ObjectVersion: "v1"},
+	}
+
+	g.Expect(inv.CountByGroupKind()).To(Equal(map[schema.GroupKind]int{
+		{Group: "apps", Kind: "Deployment"}: 2,
+		{Group: "", Kind: "Service"}:        1,
+	}))
+}
+
+func TestInventory_GroupVersionKinds(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_web_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "default_app__Service", ObjectVersion: "v1"},
+		{ObjectID: "default_app_autoscaling_HorizontalPodAutoscaler", ObjectVersion: "v2"},
+		{ObjectID: "invalid", ObjectVersion: "v1"},
+	}
+
+	g.Expect(inv.GroupVersionKinds()).To(Equal([]schema.GroupVersionKind{
+		{Group: "", Version: "v1", Kind: "Service"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"},
+	}))
+}
+
+func TestInventory_FindEntry(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_app_apps_Deployment", ObjectVersion: "v1", Status: ResourceApplied},
+		{ObjectID: "_cluster-admin_rbac.authorization.k8s.io_ClusterRole", ObjectVersion: "v1"},
+	}
+
+	entry, found := inv.FindEntry(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "app", "default")
+	g.Expect(found).To(BeTrue())
+	g.Expect(entry).To(Equal(inv.Resources[0]))
+
+	entry, found = inv.FindEntry(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, "cluster-admin", "")
+	g.Expect(found).To(BeTrue())
+	g.Expect(entry.ObjectVersion).To(Equal("v1"))
+
+	_, found = inv.FindEntry(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "app", "prod")
+	g.Expect(found).To(BeFalse())
+}
+
+func TestInventory_Equal(t *testing.T) {
+	g := NewWithT(t)
+
+	a := NewInventory("test", "default")
+	a.SetSource("oci://registry/app", "1.0.0", nil)
+	a.Metadata = map[string]string{"env": "prod"}
+	a.LastAppliedAt = "2021-11-05T10:30:00Z"
+	a.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+	}
+
+	b := a.DeepCopy()
+	b.LastAppliedAt = ""
+	b.Resources = []Resource{a.Resources[1], a.Resources[0], a.Resources[1]}
+	g.Expect(a.Equal(b)).To(BeTrue())
+	g.Expect(b.Equal(a)).To(BeTrue())
+
+	b.Resources[0].Status = ResourceApplied
+	g.Expect(a.Equal(b)).To(BeFalse())
+
+	c := a.DeepCopy()
+	c.Metadata["env"] = "dev"
+	g.Expect(a.Equal(c)).To(BeFalse())
+
+	d := a.DeepCopy()
+	d.Resources = d.Resources[:1]
+	g.Expect(a.Equal(d)).To(BeFalse())
+	g.Expect(d.Equal(a)).To(BeFalse())
+
+	g.Expect(a.Equal(nil)).To(BeFalse())
+	g.Expect(a.Equal(NewInventory("other", "default"))).To(BeFalse())
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inventorytest contains an in-memory inventory store for testing.
+package inventorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/stefanprodan/kustomizer/pkg/inventory"
+)
+
+// FakeStore is an in-memory inventory.Store keyed by inventory namespace and name.
+type FakeStore struct {
+	mu          sync.Mutex
+	inventories map[string]*inventory.Inventory
+	errors      map[string]error
+}
+
+var _ inventory.Store = &FakeStore{}
+
+// NewFakeStore returns a FakeStore containing copies of the given inventories.
+func NewFakeStore(inventories ...*inventory.Inventory) *FakeStore {
+	f := &FakeStore{
+		inventories: make(map[string]*inventory.Inventory),
+		errors:      make(map[string]error),
+	}
+	for _, i := range inventories {
+		f.inventories[key(i)] = i.DeepCopy()
+	}
+	return f
+}
+
+// InjectError makes all the operations on the inventory with the given namespace and name fail
+// with the given error, a nil error removes the injection.
+func (f *FakeStore) InjectError(namespace, name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := namespace + "/" + name
+	if err == nil {
+		delete(f.errors, k)
+		return
+	}
+	f.errors[k] = err
+}
+
+// ApplyInventory stores a copy of the given inventory.
+func (f *FakeStore) ApplyInventory(ctx context.Context, i *inventory.Inventory, opts inventory.ApplyOptions) (*inventory.ApplyResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.errors[key(i)]; err != nil {
+		return nil, err
+	}
+
+	existing, ok := f.inventories[key(i)]
+	changed := !ok || existing.Checksum() != i.Checksum() ||
+		existing.Source != i.Source || existing.Revision != i.Revision
+	if opts.DryRun {
+		return &inventory.ApplyResult{Changed: changed}, nil
+	}
+
+	i.LastAppliedAt = time.Now().UTC().Format(time.RFC3339)
+	i.LastAppliedChecksum = i.Checksum()
+	i.Count = len(i.Resources)
+	f.inventories[key(i)] = i.DeepCopy()
+	return &inventory.ApplyResult{Changed: changed}, nil
+}
+
+// GetInventory populates the given inventory from the stored copy,
+// it returns an error matching inventory.ErrInventoryNotFound if the inventory doesn't exist.
+func (f *FakeStore) GetInventory(ctx context.Context, i *inventory.Inventory) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, err := f.get(i)
+	if err != nil {
+		return err
+	}
+	*i = *stored.DeepCopy()
+	return nil
+}
+
+// DeleteInventory removes the stored copy of the given inventory, if any.
+func (f *FakeStore) DeleteInventory(ctx context.Context, i *inventory.Inventory) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.errors[key(i)]; err != nil {
+		return err
+	}
+	delete(f.inventories, key(i))
+	return nil
+}
+
+// GetInventoryStaleObjects returns the objects of the stored inventory missing from the given one.
+func (f *FakeStore) GetInventoryStaleObjects(ctx context.Context, i *inventory.Inventory, opts inventory.PruneOptions) ([]*unstructured.Unstructured, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, err := f.get(i)
+	if err != nil {
+		if errors.Is(err, inventory.ErrInventoryNotFound) {
+			return make([]*unstructured.Unstructured, 0), nil
+		}
+		return nil, err
+	}
+
+	objects, err := stored.Diff(i)
+	if err != nil {
+		return nil, err
+	}
+	return opts.Filter(objects), nil
+}
+
+func (f *FakeStore) get(i *inventory.Inventory) (*inventory.Inventory, error) {
+	if err := f.errors[key(i)]; err != nil {
+		return nil, err
+	}
+	stored, ok := f.inventories[key(i)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", inventory.ErrInventoryNotFound, key(i))
+	}
+	return stored, nil
+}
+
+func key(i *inventory.Inventory) string {
+	return i.Namespace + "/" + i.Name
+}
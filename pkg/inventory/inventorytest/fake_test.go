@@ -0,0 +1,63 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventorytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/stefanprodan/kustomizer/pkg/inventory"
+)
+
+func TestFakeStore(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	inv := inventory.NewInventory("test", "default")
+	inv.Resources = []inventory.Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+	}
+	store := NewFakeStore(inv)
+
+	result := inventory.NewInventory("test", "default")
+	g.Expect(store.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	current := inventory.NewInventory("test", "default")
+	current.Resources = inv.Resources[:1]
+	stale, err := store.GetInventoryStaleObjects(ctx, current, inventory.PruneOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(1))
+	g.Expect(stale[0].GetName()).To(Equal("b"))
+
+	applied, err := store.ApplyInventory(ctx, current, inventory.ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(applied.Changed).To(BeTrue())
+
+	injected := errors.New("injected")
+	store.InjectError("default", "test", injected)
+	g.Expect(store.GetInventory(ctx, result)).To(MatchError(injected))
+	store.InjectError("default", "test", nil)
+
+	g.Expect(store.DeleteInventory(ctx, current)).To(Succeed())
+	err = store.GetInventory(ctx, result)
+	g.Expect(errors.Is(err, inventory.ErrInventoryNotFound)).To(BeTrue())
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// inventoryNameLabel returns the label key referencing the name of the owning inventory.
+func (s *Storage) inventoryNameLabel() string {
+	return s.Owner.Group + "/inventory-name"
+}
+
+// inventoryNamespaceLabel returns the label key referencing the namespace of the owning inventory.
+func (s *Storage) inventoryNamespaceLabel() string {
+	return s.Owner.Group + "/inventory-namespace"
+}
+
+// InventoryLabels returns the labels referencing the given inventory, set on the tracked objects
+// when ReconcileOptions.InventoryLabels is enabled.
+func (s *Storage) InventoryLabels(i *Inventory) map[string]string {
+	return map[string]string{
+		s.inventoryNameLabel():      i.Name,
+		s.inventoryNamespaceLabel(): i.Namespace,
+	}
+}
+
+// SetInventoryLabels adds the labels referencing the given inventory to the objects.
+func (s *Storage) SetInventoryLabels(objects []*unstructured.Unstructured, i *Inventory) {
+	for _, obj := range objects {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for k, v := range s.InventoryLabels(i) {
+			labels[k] = v
+		}
+		obj.SetLabels(labels)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// logger returns the storage logger, or a logger discarding all messages if none is set.
+func (s *Storage) logger() logr.Logger {
+	if s.Logger.GetSink() == nil {
+		return logr.Discard()
+	}
+	return s.Logger
+}
+
+// logOperation logs the outcome of the given operation on the given inventory.
+// A missing inventory isn't logged as an error, as it's an expected outcome of get.
+func (s *Storage) logOperation(operation string, i *Inventory, err error) {
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	log := s.logger().WithValues(
+		"operation", operation,
+		"object", s.backendKind()+"/"+client.ObjectKeyFromObject(obj).String(),
+		"entries", len(i.Resources),
+	)
+	switch {
+	case err == nil:
+		log.V(1).Info("inventory operation succeeded")
+	case errors.Is(err, ErrInventoryNotFound):
+		log.V(1).Info("inventory not found")
+	default:
+		log.Error(err, "inventory operation failed")
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_Logger(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+
+	var lines []string
+	s.Logger = funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 1})
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("missing", "default"))).ToNot(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{Attachments: map[string]string{resourcesKey: ""}})).Error().To(HaveOccurred())
+
+	g.Expect(lines).To(HaveLen(3))
+	g.Expect(lines[0]).To(ContainSubstring(`"msg"="inventory operation succeeded" "operation"="apply" "object"="ConfigMap/default/inv-test" "entries"=1`))
+	g.Expect(lines[1]).To(ContainSubstring(`"msg"="inventory not found" "operation"="get"`))
+	g.Expect(lines[2]).To(ContainSubstring(`"msg"="inventory operation failed"`))
+	g.Expect(lines[2]).To(ContainSubstring(`"error"=`))
+}
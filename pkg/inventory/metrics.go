@@ -0,0 +1,93 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "kustomizer"
+	metricsSubsystem = "inventory"
+
+	getOperation = "get"
+
+	successOutcome = "success"
+	errorOutcome   = "error"
+)
+
+// Metrics records Prometheus metrics for the inventory storage operations.
+// A nil Metrics disables the collection.
+type Metrics struct {
+	operations *prometheus.CounterVec
+	entries    *prometheus.HistogramVec
+	payload    *prometheus.HistogramVec
+}
+
+// NewMetrics returns the inventory metrics registered with the given registerer.
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "operations_total",
+			Help:      "Total number of inventory operations by operation, namespace and outcome.",
+		}, []string{"operation", "namespace", "outcome"}),
+		entries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "entries",
+			Help:      "Number of entries per applied inventory.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}, []string{"namespace"}),
+		payload: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "payload_bytes",
+			Help:      "Size in bytes of the serialized entries per applied inventory.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}, []string{"namespace"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.operations, m.entries, m.payload} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// observeOperation counts the given operation by its outcome.
+func (m *Metrics) observeOperation(operation, namespace string, err error) {
+	if m == nil {
+		return
+	}
+	outcome := successOutcome
+	if err != nil {
+		outcome = errorOutcome
+	}
+	m.operations.WithLabelValues(operation, namespace, outcome).Inc()
+}
+
+// observeApply records the size of an applied inventory.
+func (m *Metrics) observeApply(namespace string, entries, bytes int) {
+	if m == nil {
+		return
+	}
+	m.entries.WithLabelValues(namespace).Observe(float64(entries))
+	m.payload.WithLabelValues(namespace).Observe(float64(bytes))
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_Metrics(t *testing.T) {
+	g := NewWithT(t)
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	s := newTestStorage()
+	s.Metrics = metrics
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("missing", "default"))).ToNot(Succeed())
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+
+	g.Expect(testutil.ToFloat64(metrics.operations.WithLabelValues(ApplyAction, "default", successOutcome))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(metrics.operations.WithLabelValues(getOperation, "default", successOutcome))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(metrics.operations.WithLabelValues(getOperation, "default", errorOutcome))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(metrics.operations.WithLabelValues(DeleteAction, "default", successOutcome))).To(Equal(1.0))
+	g.Expect(testutil.CollectAndCount(metrics.entries)).To(Equal(1))
+
+	_, err = NewMetrics(registry)
+	g.Expect(err).To(HaveOccurred())
+}
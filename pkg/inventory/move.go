@@ -0,0 +1,108 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// MoveInventory moves the stored inventory to the given name and namespace, together with its
+// metadata, attachments, expiry, inactive state and history, then deletes the storage of the
+// previous identity. The tracked objects are left untouched. If writing the new storage fails,
+// the partially written storage is removed and the previous one is kept. The move fails if an
+// inventory already exists under the new identity.
+func (s *Storage) MoveInventory(ctx context.Context, from *Inventory, toName, toNamespace string) error {
+	stored := NewInventory(from.Name, from.Namespace)
+	opts, err := s.getInventory(ctx, stored)
+	if err != nil {
+		return err
+	}
+
+	target := NewInventory(toName, toNamespace)
+	if err := s.GetInventory(ctx, target); err == nil {
+		return fmt.Errorf("inventory %s/%s already exists", toNamespace, toName)
+	} else if !errors.Is(err, ErrInventoryNotFound) {
+		return err
+	}
+
+	history, err := s.listHistoryObjects(ctx, stored)
+	if err != nil {
+		return err
+	}
+
+	to := stored.DeepCopy()
+	to.Name = toName
+	to.Namespace = toNamespace
+	to.ResourceVersion = ""
+
+	rollback := func(err error) error {
+		if derr := s.DeleteInventory(ctx, to); derr != nil {
+			return utilerrors.NewAggregate([]error{err, derr})
+		}
+		return err
+	}
+
+	patchOpts := s.patchOptions(ApplyOptions{})
+	prefix := s.storageName(stored.Name, stored.Namespace)
+	for _, obj := range history {
+		moved := s.newStorageObject(to.Name, to.Namespace)
+		moved.SetName(moved.GetName() + strings.TrimPrefix(obj.GetName(), prefix))
+		s.setObjectKeys(moved, map[string]string{s.componentLabel(): historyKindName})
+		data, err := s.readData(ctx, obj)
+		if err != nil {
+			return rollback(err)
+		}
+		annotations := obj.GetAnnotations()
+		for k, v := range moved.GetAnnotations() {
+			annotations[k] = v
+		}
+		key := s.payloadKey(data)
+		if err := s.sign(moved, annotations, data[key]); err != nil {
+			return rollback(err)
+		}
+		moved.SetAnnotations(annotations)
+		if err := s.applyHistoryObject(ctx, moved, key, data, patchOpts); err != nil {
+			return rollback(err)
+		}
+	}
+
+	if _, err := s.ApplyInventory(ctx, to, opts); err != nil {
+		return rollback(err)
+	}
+
+	// applying activates the inventory, the inactive state is restored with the last applied time
+	annotations := map[string]interface{}{}
+	if stored.LastAppliedAt != "" {
+		annotations[s.Owner.Group+"/last-applied-time"] = stored.LastAppliedAt
+	}
+	if stored.Inactive {
+		annotations[s.inactiveAnnotation()] = "true"
+		annotations[s.inactiveSinceAnnotation()] = stored.InactiveSince
+	}
+	if len(annotations) > 0 {
+		if err := s.patchAnnotations(ctx, s.newStorageObject(to.Name, to.Namespace), annotations); err != nil {
+			return rollback(err)
+		}
+	}
+
+	return s.DeleteInventory(ctx, stored)
+}
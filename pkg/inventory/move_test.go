@@ -0,0 +1,92 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_MoveInventory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 5
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Metadata = map[string]string{"author": "dev@example.com"}
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	inv.SetSource("oci://registry/app", "1.0.1", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+
+	g.Expect(s.MoveInventory(ctx, inv, "moved", "apps")).To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrInventoryNotFound))
+
+	moved := NewInventory("moved", "apps")
+	g.Expect(s.GetInventory(ctx, moved)).To(Succeed())
+	g.Expect(moved.Resources).To(Equal(stored.Resources))
+	g.Expect(moved.Revision).To(Equal("1.0.1"))
+	g.Expect(moved.Metadata).To(Equal(stored.Metadata))
+	g.Expect(moved.LastAppliedAt).To(Equal(stored.LastAppliedAt))
+
+	history, err := s.ListHistory(ctx, moved)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(1))
+	g.Expect(history[0].Revision).To(Equal("1.0.0"))
+	history, err = s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(BeEmpty())
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.MoveInventory(ctx, inv, "moved", "apps")).To(MatchError(ContainSubstring("already exists")))
+}
+
+func TestStorage_MoveInventoryState(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	opts := ApplyOptions{
+		Attachments: map[string]string{"report": "no changes"},
+		TTL:         time.Hour,
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, opts)).Error().To(Succeed())
+	g.Expect(s.DeactivateInventory(ctx, inv)).To(Succeed())
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.ExpiresAt).ToNot(BeEmpty())
+
+	g.Expect(s.MoveInventory(ctx, inv, "moved", "apps")).To(Succeed())
+
+	moved := NewInventory("moved", "apps")
+	g.Expect(s.GetInventory(ctx, moved)).To(Succeed())
+	g.Expect(moved.ExpiresAt).To(Equal(stored.ExpiresAt))
+	g.Expect(moved.Inactive).To(BeTrue())
+	g.Expect(moved.InactiveSince).To(Equal(stored.InactiveSince))
+	g.Expect(s.GetAttachment(ctx, moved, "report")).To(Equal("no changes"))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+// NameMapper maps an inventory to its storage object. The shards and history of the inventory
+// are stored in objects named after the storage object. The inventories of a namespace are
+// listed in the storage namespace mapped for an empty name.
+type NameMapper interface {
+	// StorageObject returns the name and namespace of the storage object of the inventory with the
+	// given name and namespace, and the labels added to it. The labels can't override the kustomizer labels.
+	StorageObject(name, namespace string) (objName string, objNamespace string, labels map[string]string)
+}
+
+// DefaultNameMapper is the NameMapper used when Storage.NameMapper isn't set, it's configured
+// with the Storage NamePrefix, NameSuffix and DefaultNamespace.
+type DefaultNameMapper struct {
+	// Prefix is prepended to the inventory name, defaults to 'inv-'.
+	Prefix string
+
+	// Suffix is appended to the inventory name, optional.
+	Suffix string
+
+	// DefaultNamespace is the namespace of the storage object for inventories without a namespace.
+	DefaultNamespace string
+}
+
+// StorageObject returns '<prefix><name><suffix>' in the inventory namespace, or in the default
+// namespace for inventories without a namespace, and no labels.
+func (m DefaultNameMapper) StorageObject(name, namespace string) (string, string, map[string]string) {
+	prefix := storagePrefix
+	if m.Prefix != "" {
+		prefix = m.Prefix
+	}
+	if namespace == "" {
+		namespace = m.DefaultNamespace
+	}
+	return prefix + name + m.Suffix, namespace, nil
+}
+
+// nameMapper returns the configured NameMapper or the default one.
+func (s *Storage) nameMapper() NameMapper {
+	if s.NameMapper != nil {
+		return s.NameMapper
+	}
+	return DefaultNameMapper{
+		Prefix:           s.NamePrefix,
+		Suffix:           s.NameSuffix,
+		DefaultNamespace: s.DefaultNamespace,
+	}
+}
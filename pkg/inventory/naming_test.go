@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+type centralNameMapper struct{}
+
+func (centralNameMapper) StorageObject(name, namespace string) (string, string, map[string]string) {
+	return namespace + "-" + name, "inventories", map[string]string{"team": namespace}
+}
+
+func TestStorage_NameMapper(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.NameMapper = centralNameMapper{}
+	ctx := context.Background()
+
+	inv := NewInventory("app", "apps")
+	inv.Resources = []Resource{{ObjectID: "apps_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "apps-app", Namespace: "inventories"}, cm)).To(Succeed())
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue("team", "apps"))
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue(nameLabelKey, "app"))
+
+	result := NewInventory("app", "apps")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("app", "web"), ApplyOptions{})).Error().To(Succeed())
+	list, err := s.ListInventories(ctx, "apps")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(list).To(HaveLen(1))
+	g.Expect(list[0].Namespace).To(Equal("apps"))
+	g.Expect(list[0].Resources).To(Equal(inv.Resources))
+	meta, err := s.ListInventoriesMeta(ctx, "web")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(meta).To(HaveLen(1))
+	g.Expect(meta[0].Namespace).To(Equal("web"))
+	g.Expect(s.ListInventoriesMeta(ctx, "")).To(HaveLen(2))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, result)).To(MatchError(ErrInventoryNotFound))
+}
+
+func TestStorage_InventoryNameWithoutLabels(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.NamePrefix = "release-"
+	s.NameSuffix = "-v1"
+
+	cm := s.newConfigMap("app", "apps")
+	cm.SetLabels(nil)
+	g.Expect(s.inventoryName(cm)).To(Equal("app"))
+	g.Expect(s.inventoryNamespace(cm)).To(Equal("apps"))
+}
+
+func TestDefaultNameMapper(t *testing.T) {
+	g := NewWithT(t)
+
+	name, namespace, labels := DefaultNameMapper{DefaultNamespace: "kube-system"}.StorageObject("app", "")
+	g.Expect(name).To(Equal("inv-app"))
+	g.Expect(namespace).To(Equal("kube-system"))
+	g.Expect(labels).To(BeEmpty())
+
+	name, namespace, _ = DefaultNameMapper{Prefix: "release-", Suffix: "-v1"}.StorageObject("app", "apps")
+	g.Expect(name).To(Equal("release-app-v1"))
+	g.Expect(namespace).To(Equal("apps"))
+}
+
+func TestStorage_NameMapperHistory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.NameMapper = centralNameMapper{}
+	s.HistoryLimit = 2
+	ctx := context.Background()
+
+	apps := NewInventory("app", "apps")
+	web := NewInventory("app", "web")
+	for _, inv := range []*Inventory{apps, web} {
+		for _, revision := range []string{"1.0.0", "1.0.1"} {
+			inv.SetSource("oci://registry/"+inv.Namespace, revision, nil)
+			g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+		}
+	}
+
+	history, err := s.ListHistory(ctx, apps)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(1))
+	g.Expect(history[0].Source).To(Equal("oci://registry/apps"))
+
+	g.Expect(s.DeleteInventory(ctx, apps)).To(Succeed())
+	history, err = s.ListHistory(ctx, web)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(1))
+	g.Expect(history[0].Source).To(Equal("oci://registry/web"))
+	g.Expect(s.RestoreRevision(ctx, web, "1.0.0")).To(Succeed())
+}
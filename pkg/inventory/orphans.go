@@ -0,0 +1,126 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FindOrphans returns the objects of the given kinds from the namespace that carry the owner labels
+// but are not referenced by any inventory, e.g. leftovers from an interrupted apply.
+// If the namespace is empty, the objects are looked up across all namespaces.
+func (s *Storage) FindOrphans(ctx context.Context, namespace string, gvks []schema.GroupVersionKind) ([]*unstructured.Unstructured, error) {
+	inventories, err := s.ListInventories(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool)
+	for _, i := range inventories {
+		for _, entry := range i.Resources {
+			tracked[entry.ObjectID] = true
+		}
+	}
+
+	var orphans []*unstructured.Unstructured
+	for _, gvk := range gvks {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := s.withTimeout(s.Manager.Client()).List(ctx, list, client.InNamespace(namespace), client.HasLabels{s.Owner.Group + "/name"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s, error: %w", gvk.Kind, err)
+		}
+
+		for n := range list.Items {
+			obj := &list.Items[n]
+			if !tracked[object.UnstructuredToObjMetadata(obj).String()] {
+				orphans = append(orphans, obj)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// FindOwningInventory returns the inventory that tracks the given object, or an error matching
+// ErrInventoryNotFound. When inventories are given, only these are searched. Otherwise, the
+// inventories referenced by the object inventory labels and owner labels are checked first,
+// followed by the inventories in the object namespace and finally by the inventories across
+// all namespaces.
+func (s *Storage) FindOwningInventory(ctx context.Context, obj *unstructured.Unstructured, inventories ...*Inventory) (*Inventory, error) {
+	id := object.UnstructuredToObjMetadata(obj).String()
+	notFound := newNotFoundError(fmt.Errorf("no inventory tracks %s", id))
+
+	if len(inventories) > 0 {
+		if i := findTracking(inventories, id); i != nil {
+			return i, nil
+		}
+		return nil, notFound
+	}
+
+	labels := obj.GetLabels()
+	for _, keys := range [][2]string{
+		{s.inventoryNameLabel(), s.inventoryNamespaceLabel()},
+		{s.Owner.Group + "/name", s.Owner.Group + "/namespace"},
+	} {
+		name, ok := labels[keys[0]]
+		if !ok {
+			continue
+		}
+		i := NewInventory(name, labels[keys[1]])
+		if err := s.GetInventory(ctx, i); err != nil {
+			if !errors.Is(err, ErrInventoryNotFound) {
+				return nil, err
+			}
+		} else if findTracking([]*Inventory{i}, id) != nil {
+			return i, nil
+		}
+	}
+
+	namespaces := []string{obj.GetNamespace()}
+	if obj.GetNamespace() != "" {
+		namespaces = append(namespaces, "")
+	}
+	for _, namespace := range namespaces {
+		list, err := s.ListInventories(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if i := findTracking(list, id); i != nil {
+			return i, nil
+		}
+	}
+	return nil, notFound
+}
+
+// findTracking returns the first inventory with an entry for the given object ID.
+func findTracking(inventories []*Inventory, id string) *Inventory {
+	for _, i := range inventories {
+		for _, entry := range i.Resources {
+			if entry.ObjectID == id {
+				return i
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFindOrphans(t *testing.T) {
+	g := NewWithT(t)
+	ownerLabels := map[string]string{testOwner.Group + "/name": "test"}
+	s := newTestStorage(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "tracked", Namespace: "default", Labels: ownerLabels}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default", Labels: ownerLabels}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "default"}},
+	)
+	ctx := context.Background()
+
+	inv := NewInventory("test", "inventories")
+	inv.Resources = []Resource{{ObjectID: "default_tracked__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	orphans, err := s.FindOrphans(ctx, "default", []schema.GroupVersionKind{corev1.SchemeGroupVersion.WithKind("ConfigMap")})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(orphans).To(HaveLen(1))
+	g.Expect(orphans[0].GetName()).To(Equal("orphan"))
+}
+
+func TestFindOwningInventory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	first := NewInventory("first", "apps")
+	first.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, first, ApplyOptions{})).Error().To(Succeed())
+
+	second := NewInventory("second", "default")
+	second.Resources = []Resource{{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, second, ApplyOptions{})).Error().To(Succeed())
+
+	newObject := func(name string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	owner, err := s.FindOwningInventory(ctx, newObject("a", map[string]string{
+		testOwner.Group + "/name":      "first",
+		testOwner.Group + "/namespace": "apps",
+	}))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(owner.Name).To(Equal("first"))
+
+	owner, err = s.FindOwningInventory(ctx, newObject("a", nil))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(owner.Name).To(Equal("first"))
+
+	owner, err = s.FindOwningInventory(ctx, newObject("b", nil), first, second)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(owner.Name).To(Equal("second"))
+
+	_, err = s.FindOwningInventory(ctx, newObject("c", nil))
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
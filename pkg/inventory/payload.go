@@ -0,0 +1,363 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	resourcesKey     = "resources"
+	artifactsKey     = "artifacts"
+	compressedKeyExt = ".gz"
+
+	// payloadVersion is the version of the inventory data format.
+	payloadVersion = 1
+)
+
+// payloadEnvelope is the versioned format of the inventory data,
+// inventories stored before versioning contain only the entries array.
+type payloadEnvelope struct {
+	Version int        `json:"version"`
+	Entries []Resource `json:"entries"`
+}
+
+// dataKey returns the storage data key of the inventory resources.
+func (s *Storage) dataKey() string {
+	if s.DataKey != "" {
+		return s.DataKey
+	}
+	return resourcesKey
+}
+
+// validateDataKey returns an error if the data key, or its compressed variant, isn't a valid
+// data key or collides with the artifacts key.
+func (s *Storage) validateDataKey() error {
+	key := s.dataKey()
+	if key == artifactsKey {
+		return fmt.Errorf("invalid data key '%s', the key is reserved for the artifacts", key)
+	}
+	for _, k := range []string{key, key + compressedKeyExt} {
+		if errs := validation.IsConfigMapKey(k); len(errs) > 0 {
+			return fmt.Errorf("invalid data key '%s': %s", k, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// Encryptor encrypts the inventory payload at rest.
+type Encryptor interface {
+	// Encrypt returns the ciphertext of the given payload.
+	Encrypt(plaintext []byte) ([]byte, error)
+
+	// Decrypt returns the payload of the given ciphertext.
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Codec marshals and unmarshals the inventory data, implementations must produce
+// and accept standard JSON so that the stored format doesn't depend on the codec.
+type Codec interface {
+	// Marshal returns the JSON encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal parses the JSON encoded data and stores the result in the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// jsonCodec is the default Codec, it uses the apimachinery JSON package.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// codec returns the configured Codec or the default one.
+func (s *Storage) codec() Codec {
+	if s.Codec != nil {
+		return s.Codec
+	}
+	return jsonCodec{}
+}
+
+// encryptedAnnotation returns the annotation flagging an encrypted inventory payload.
+func (s *Storage) encryptedAnnotation() string {
+	return s.Owner.Group + "/encrypted"
+}
+
+// encodeResources marshals the given resources and returns the storage data key and value.
+// When compression is enabled, the payload is gzipped, and when an encryptor is set, the payload
+// is encrypted. Compressed or encrypted payloads are base64 encoded. Unless the order is preserved,
+// the resources are sorted so that identical inventories produce the same payload.
+func (s *Storage) encodeResources(resources []Resource) (string, string, error) {
+	if resources == nil {
+		resources = []Resource{}
+	}
+	if !s.PreserveOrder {
+		resources = sortResources(resources)
+	}
+	envelope := payloadEnvelope{Version: payloadVersion, Entries: resources}
+
+	payload, err := s.codec().Marshal(envelope)
+	if err != nil {
+		return "", "", err
+	}
+	if s.PrettyPrint {
+		var buf bytes.Buffer
+		if err := stdjson.Indent(&buf, payload, "", "  "); err != nil {
+			return "", "", err
+		}
+		payload = buf.Bytes()
+	}
+
+	key := s.dataKey()
+	if s.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return "", "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", "", err
+		}
+		payload = buf.Bytes()
+		key = key + compressedKeyExt
+	}
+
+	if s.Encryptor != nil {
+		payload, err = s.Encryptor.Encrypt(payload)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encrypt inventory data, error: %w", err)
+		}
+	}
+
+	if !s.Compress && s.Encryptor == nil {
+		return key, string(payload), nil
+	}
+	return key, base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// payloadReader returns a reader over the resources payload of the given storage data,
+// the plain and the compressed formats are detected automatically.
+// It returns false if the data contains no resources.
+func (s *Storage) payloadReader(data map[string]string, encrypted bool) (io.ReadCloser, bool, error) {
+	value, compressed := data[s.dataKey()+compressedKeyExt]
+	if !compressed {
+		var ok bool
+		if value, ok = data[s.dataKey()]; !ok {
+			return nil, false, nil
+		}
+	}
+
+	var r io.Reader = strings.NewReader(value)
+	if encrypted {
+		if s.Encryptor == nil {
+			return nil, true, fmt.Errorf("inventory data is encrypted but no encryptor is configured")
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, true, err
+		}
+		payload, err := s.Encryptor.Decrypt(ciphertext)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to decrypt inventory data, error: %w", err)
+		}
+		r = bytes.NewReader(payload)
+	} else if compressed {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	if !compressed {
+		return io.NopCloser(r), true, nil
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, true, err
+	}
+	return zr, true, nil
+}
+
+// decodeResources unmarshals the resources from the given storage data.
+// It returns false if the data contains no resources, and an error matching
+// ErrCorruptInventory if the resources can't be parsed.
+func (s *Storage) decodeResources(data map[string]string, encrypted bool) ([]Resource, bool, error) {
+	r, found, err := s.payloadReader(data, encrypted)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	defer r.Close()
+
+	if s.Codec != nil {
+		payload, err := io.ReadAll(r)
+		if err != nil {
+			return nil, true, parseError(err)
+		}
+		resources, err := unmarshalResources(s.Codec, payload)
+		if err != nil {
+			return nil, true, parseError(err)
+		}
+		return resources, true, nil
+	}
+
+	resources := []Resource{}
+	err = streamResources(r, func(entry Resource) error {
+		resources = append(resources, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, true, parseError(err)
+	}
+
+	return resources, true, nil
+}
+
+// unsupportedVersionError is returned for inventory data written in a newer format.
+type unsupportedVersionError int
+
+func (e unsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported inventory data version %d", int(e))
+}
+
+// parseError wraps the given payload decoding error so that it matches ErrCorruptInventory,
+// unless the data is in an unsupported format.
+func parseError(err error) error {
+	var version unsupportedVersionError
+	if errors.As(err, &version) {
+		return err
+	}
+	return newCorruptError(err)
+}
+
+// unmarshalResources decodes the resources from the given payload with the given codec,
+// both the versioned envelope and the legacy entries array are supported.
+func unmarshalResources(codec Codec, payload []byte) ([]Resource, error) {
+	resources := []Resource{}
+	trimmed := bytes.TrimSpace(payload)
+	switch {
+	case bytes.Equal(trimmed, []byte("null")):
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := codec.Unmarshal(trimmed, &resources); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var envelope payloadEnvelope
+		if err := codec.Unmarshal(trimmed, &envelope); err != nil {
+			return nil, err
+		}
+		if envelope.Version > payloadVersion {
+			return nil, unsupportedVersionError(envelope.Version)
+		}
+		if envelope.Entries != nil {
+			resources = envelope.Entries
+		}
+	default:
+		return nil, fmt.Errorf("invalid inventory data, expected an array of entries")
+	}
+	return resources, nil
+}
+
+// streamResources decodes the resources from the given payload one at a time and calls fn for each of them,
+// both the versioned envelope and the legacy entries array are supported.
+// The iteration stops without error when fn returns ErrStop.
+func streamResources(r io.Reader, fn func(Resource) error) error {
+	dec := stdjson.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case nil:
+		return nil
+	case stdjson.Delim('['):
+		_, err := streamEntries(dec, fn)
+		return err
+	case stdjson.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			switch key {
+			case "version":
+				var version int
+				if err := dec.Decode(&version); err != nil {
+					return err
+				}
+				if version > payloadVersion {
+					return unsupportedVersionError(version)
+				}
+			case "entries":
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if tok == nil {
+					continue
+				}
+				if tok != stdjson.Delim('[') {
+					return fmt.Errorf("invalid inventory data, expected an array of entries")
+				}
+				if stopped, err := streamEntries(dec, fn); stopped || err != nil {
+					return err
+				}
+			default:
+				var value stdjson.RawMessage
+				if err := dec.Decode(&value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid inventory data, expected an array of entries")
+	}
+}
+
+// streamEntries decodes the elements of an entries array up to and including its closing bracket.
+// It returns true if the iteration was stopped by fn.
+func streamEntries(dec *stdjson.Decoder, fn func(Resource) error) (bool, error) {
+	for dec.More() {
+		var entry Resource
+		if err := dec.Decode(&entry); err != nil {
+			return false, err
+		}
+		if err := fn(entry); err != nil {
+			if errors.Is(err, ErrStop) {
+				return true, nil
+			}
+			return false, err
+		}
+	}
+
+	_, err := dec.Token()
+	return false, err
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCompressedResources(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := NewInventory("test", "default")
+	for n := 0; n < 5000; n++ {
+		inv.Resources = append(inv.Resources, Resource{
+			ObjectID:      fmt.Sprintf("team-%d_app-%d_apps_Deployment", n%10, n),
+			ObjectVersion: "v1",
+		})
+	}
+
+	plain := &Storage{}
+	_, plainValue, err := plain.encodeResources(inv.Resources)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	s := &Storage{Compress: true}
+	key, value, err := s.encodeResources(inv.Resources)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(key).To(Equal(resourcesKey + compressedKeyExt))
+
+	t.Run("stores data under the size threshold", func(t *testing.T) {
+		g.Expect(len(value)).To(BeNumerically("<", len(plainValue)/4))
+		g.Expect(len(value)).To(BeNumerically("<", 100*1024))
+	})
+
+	t.Run("reads compressed data", func(t *testing.T) {
+		resources, found, err := s.decodeResources(map[string]string{key: value}, false)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(found).To(BeTrue())
+		g.Expect(resources).To(Equal(sortResources(inv.Resources)))
+	})
+
+	t.Run("reads plain data", func(t *testing.T) {
+		resources, found, err := s.decodeResources(map[string]string{resourcesKey: plainValue}, false)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(found).To(BeTrue())
+		g.Expect(resources).To(Equal(sortResources(inv.Resources)))
+	})
+}
+
+func TestCustomDataKey(t *testing.T) {
+	g := NewWithT(t)
+
+	resources := []Resource{{ObjectID: "default_app__Service", ObjectVersion: "v1"}}
+	s := &Storage{DataKey: "kustomizer.dev"}
+
+	key, value, err := s.encodeResources(resources)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(key).To(Equal("kustomizer.dev"))
+
+	result, found, err := s.decodeResources(map[string]string{key: value}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found).To(BeTrue())
+	g.Expect(result).To(Equal(resources))
+
+	_, found, _ = s.decodeResources(map[string]string{resourcesKey: value}, false)
+	g.Expect(found).To(BeFalse())
+}
+
+func TestValidateDataKey(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect((&Storage{}).validateDataKey()).To(Succeed())
+	g.Expect((&Storage{DataKey: "kustomizer.dev"}).validateDataKey()).To(Succeed())
+	g.Expect((&Storage{DataKey: artifactsKey}).validateDataKey()).To(MatchError(ContainSubstring("reserved")))
+	g.Expect((&Storage{DataKey: "my/key"}).validateDataKey()).To(HaveOccurred())
+	g.Expect((&Storage{DataKey: strings.Repeat("k", 251)}).validateDataKey()).To(HaveOccurred())
+}
+
+func TestVersionedPayload(t *testing.T) {
+	g := NewWithT(t)
+
+	resources := []Resource{{ObjectID: "default_app__Service", ObjectVersion: "v1"}}
+	s := &Storage{PrettyPrint: true}
+
+	key, value, err := s.encodeResources(resources)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal(`{
+  "version": 1,
+  "entries": [
+    {
+      "id": "default_app__Service",
+      "ver": "v1"
+    }
+  ]
+}`))
+
+	result, _, err := s.decodeResources(map[string]string{key: value}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(resources))
+
+	legacy := `[{"id":"default_app__Service","ver":"v1"}]`
+	result, _, err = s.decodeResources(map[string]string{key: legacy}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(resources))
+
+	_, _, err = s.decodeResources(map[string]string{key: `{"version":2,"entries":[]}`}, false)
+	g.Expect(err).To(MatchError("unsupported inventory data version 2"))
+}
+
+type countingCodec struct {
+	jsonCodec
+	calls int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.calls++
+	return c.jsonCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.calls++
+	return c.jsonCodec.Unmarshal(data, v)
+}
+
+func TestCustomCodec(t *testing.T) {
+	g := NewWithT(t)
+
+	resources := []Resource{{ObjectID: "default_app__Service", ObjectVersion: "v1"}}
+	codec := &countingCodec{}
+	custom := &Storage{Codec: codec}
+	standard := &Storage{}
+
+	key, value, err := custom.encodeResources(resources)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, expected, err := standard.encodeResources(resources)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal(expected))
+
+	result, _, err := custom.decodeResources(map[string]string{key: value}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(resources))
+	g.Expect(codec.calls).To(Equal(2))
+
+	legacy := `[{"id":"default_app__Service","ver":"v1"}]`
+	result, _, err = custom.decodeResources(map[string]string{key: legacy}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(resources))
+
+	_, _, err = custom.decodeResources(map[string]string{key: `{"version":2,"entries":[]}`}, false)
+	g.Expect(err).To(MatchError("unsupported inventory data version 2"))
+}
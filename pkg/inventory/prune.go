@@ -0,0 +1,106 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PruneEmptyOptions contains options for PruneEmptyInventories.
+type PruneEmptyOptions struct {
+	// DryRun reports the empty inventories without deleting them.
+	DryRun bool
+}
+
+// PruneEmptyInventories deletes the inventories from the given namespace whose tracked objects
+// no longer exist in the cluster, and returns their '<namespace>/<name>' keys.
+// If the namespace is empty, the inventories are pruned across all namespaces.
+func (s *Storage) PruneEmptyInventories(ctx context.Context, namespace string, opts PruneEmptyOptions) ([]string, error) {
+	inventories, err := s.ListInventories(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	empty := make([]bool, len(inventories))
+	err = s.forEach(ctx, len(inventories), func(ctx context.Context, n int) error {
+		live, err := s.hasLiveObjects(ctx, inventories[n])
+		empty[n] = !live
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for n, i := range inventories {
+		if !empty[n] {
+			continue
+		}
+		if !opts.DryRun {
+			if err := s.DeleteInventory(ctx, i); err != nil {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, fmt.Sprintf("%s/%s", i.Namespace, i.Name))
+	}
+	return pruned, nil
+}
+
+// hasLiveObjects returns true if at least one of the inventory entries exists in the cluster.
+func (s *Storage) hasLiveObjects(ctx context.Context, i *Inventory) (bool, error) {
+	objects, err := i.ListObjects()
+	if err != nil {
+		return false, err
+	}
+
+	for _, obj := range objects {
+		exists, err := s.objectExists(ctx, obj)
+		if exists || err != nil {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// objectExists returns true if the given object exists in the cluster,
+// objects of kinds unknown to the cluster are reported as missing.
+func (s *Storage) objectExists(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	existing, err := s.liveObject(ctx, obj)
+	return existing != nil, err
+}
+
+// liveObject returns the cluster state of the given object, or nil if the object
+// doesn't exist or its kind is unknown to the cluster.
+func (s *Storage) liveObject(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	err := s.withTimeout(s.Manager.Client()).Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	switch {
+	case err == nil:
+		return existing, nil
+	case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get %s/%s, error: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPruneEmptyInventories(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default"}})
+	ctx := context.Background()
+
+	live := NewInventory("live", "default")
+	live.Resources = []Resource{
+		{ObjectID: "default_gone__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_live__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, live, ApplyOptions{})).Error().To(Succeed())
+
+	empty := NewInventory("empty", "default")
+	empty.Resources = []Resource{{ObjectID: "default_gone__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, empty, ApplyOptions{})).Error().To(Succeed())
+
+	pruned, err := s.PruneEmptyInventories(ctx, "default", PruneEmptyOptions{DryRun: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(Equal([]string{"default/empty"}))
+	g.Expect(s.GetInventory(ctx, NewInventory("empty", "default"))).To(Succeed())
+
+	pruned, err = s.PruneEmptyInventories(ctx, "default", PruneEmptyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(Equal([]string{"default/empty"}))
+
+	inventories, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inventories).To(HaveLen(1))
+	g.Expect(inventories[0].Name).To(Equal("live"))
+}
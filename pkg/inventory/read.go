@@ -0,0 +1,102 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RateLimiter throttles API calls, it's implemented by the golang.org/x/time/rate
+// limiters and by the client-go flowcontrol rate limiters.
+type RateLimiter interface {
+	// Wait blocks until the next call is allowed or the context is done.
+	Wait(ctx context.Context) error
+}
+
+// ReadOptions tune the API reads made while computing the stale objects.
+type ReadOptions struct {
+	// PageSize is the maximum number of objects returned by each list call, zero disables pagination.
+	PageSize int64
+
+	// RateLimiter throttles the get and list calls, optional.
+	RateLimiter RateLimiter
+}
+
+// withReadOptions wraps the given client when read options are set.
+func withReadOptions(c client.Client, opts ReadOptions) client.Client {
+	if opts.PageSize <= 0 && opts.RateLimiter == nil {
+		return c
+	}
+	return &readClient{Client: c, opts: opts}
+}
+
+// readClient throttles and paginates the reads of the wrapped client.
+type readClient struct {
+	client.Client
+	opts ReadOptions
+}
+
+func (c *readClient) wait(ctx context.Context) error {
+	if c.opts.RateLimiter == nil {
+		return nil
+	}
+	return c.opts.RateLimiter.Wait(ctx)
+}
+
+func (c *readClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *readClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if c.opts.PageSize <= 0 {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		return c.Client.List(ctx, list, opts...)
+	}
+
+	var items []runtime.Object
+	var continueToken string
+	for {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		pageOpts := append(append([]client.ListOption{}, opts...), client.Limit(c.opts.PageSize), client.Continue(continueToken))
+		if err := c.Client.List(ctx, list, pageOpts...); err != nil {
+			return err
+		}
+		page, err := apimeta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		// the items point into the list, which the next page can be decoded into
+		for _, item := range page {
+			items = append(items, item.DeepCopyObject())
+		}
+		if continueToken = list.GetContinue(); continueToken == "" {
+			break
+		}
+	}
+	return apimeta.SetList(list, items)
+}
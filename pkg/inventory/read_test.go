@@ -0,0 +1,102 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+type countingLimiter struct {
+	calls int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.calls++
+	return nil
+}
+
+// pagingClient serves a list of ConfigMaps one page at a time,
+// reusing the items of the given list as the decoding of a real client does.
+type pagingClient struct {
+	client.Client
+	items []corev1.ConfigMap
+	calls int
+}
+
+func (c *pagingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	c.calls++
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	start, _ := strconv.Atoi(listOpts.Continue)
+	end := start + int(listOpts.Limit)
+	cmList := list.(*corev1.ConfigMapList)
+	cmList.Continue = ""
+	if end < len(c.items) {
+		cmList.Continue = strconv.Itoa(end)
+	} else {
+		end = len(c.items)
+	}
+	cmList.Items = append(cmList.Items[:0], c.items[start:end]...)
+	return nil
+}
+
+func TestReadClient(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	backend := &pagingClient{}
+	for n := 0; n < 5; n++ {
+		backend.items = append(backend.items, corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(n)}})
+	}
+	limiter := &countingLimiter{}
+	c := withReadOptions(backend, ReadOptions{PageSize: 2, RateLimiter: limiter})
+
+	list := &corev1.ConfigMapList{}
+	g.Expect(c.List(ctx, list)).To(Succeed())
+	g.Expect(list.Items).To(Equal(backend.items))
+	g.Expect(backend.calls).To(Equal(3))
+	g.Expect(limiter.calls).To(Equal(3))
+
+	g.Expect(withReadOptions(backend, ReadOptions{})).To(BeIdenticalTo(backend))
+}
+
+func TestGetInventoryStaleObjects_ReadOptions(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	limiter := &countingLimiter{}
+	stale, err := s.GetInventoryStaleObjects(ctx, NewInventory("test", "default"), PruneOptions{
+		Read: ReadOptions{RateLimiter: limiter},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(1))
+	g.Expect(limiter.calls).To(Equal(1))
+	g.Expect(s.StorageClient).To(BeNil())
+}
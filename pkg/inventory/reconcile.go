@@ -0,0 +1,195 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// ReconcileOptions contains options for Reconcile.
+type ReconcileOptions struct {
+	// Force recreates the objects that contain immutable field changes.
+	Force bool
+
+	// Inventory contains the options used to apply the inventory.
+	Inventory ApplyOptions
+
+	// Prune contains the options used to select the stale objects.
+	Prune PruneOptions
+
+	// InventoryLabels adds the labels returned by Storage.InventoryLabels to the applied objects.
+	InventoryLabels bool
+
+	// SourceAnnotations adds the annotations returned by Storage.SourceAnnotations to the applied
+	// objects, so that SyncMetadataFromObjects can detect out-of-band changes. The objects are
+	// updated on every revision change.
+	SourceAnnotations bool
+}
+
+// ReconcileResult contains the changes made by Reconcile.
+type ReconcileResult struct {
+	// Created are the objects that didn't exist in the cluster.
+	Created []ssa.ChangeSetEntry
+
+	// Updated are the existing objects that were modified.
+	Updated []ssa.ChangeSetEntry
+
+	// Unchanged are the existing objects already in the desired state.
+	Unchanged []ssa.ChangeSetEntry
+
+	// Deleted are the stale objects removed from the cluster.
+	Deleted []ssa.ChangeSetEntry
+}
+
+// Reconcile applies the given objects, records them in the inventory and deletes the stale objects.
+// The inventory is written only after all the objects were applied successfully, and the stale
+// objects are deleted only after the inventory was written, so that an interrupted reconciliation
+// can be resumed from the stored inventory.
+func (s *Storage) Reconcile(ctx context.Context, i *Inventory, objects []*unstructured.Unstructured, opts ReconcileOptions) (*ReconcileResult, error) {
+	i.Resources = []Resource{}
+	if err := i.AddObjects(objects); err != nil {
+		return nil, fmt.Errorf("creating inventory failed, error: %w", err)
+	}
+	s.Manager.SetOwnerLabels(objects, i.Name, i.Namespace)
+	if opts.InventoryLabels {
+		s.SetInventoryLabels(objects, i)
+	}
+	if opts.SourceAnnotations {
+		s.SetSourceAnnotations(objects, i)
+	}
+	staleObjects, err := s.GetInventoryStaleObjects(ctx, i, opts.Prune)
+	if err != nil {
+		return nil, fmt.Errorf("inventory query failed, error: %w", err)
+	}
+
+	applyOpts := ssa.DefaultApplyOptions()
+	applyOpts.Force = opts.Force
+	changeSet, err := s.Manager.ApplyAllStaged(ctx, objects, applyOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{}
+	for _, entry := range changeSet.Entries {
+		switch entry.Action {
+		case string(ssa.CreatedAction):
+			result.Created = append(result.Created, entry)
+		case string(ssa.UnchangedAction):
+			result.Unchanged = append(result.Unchanged, entry)
+		default:
+			result.Updated = append(result.Updated, entry)
+		}
+	}
+
+	if err := s.RecordObjectDigests(ctx, i, objects); err != nil {
+		return result, fmt.Errorf("inventory digests failed, error: %w", err)
+	}
+
+	if _, err := s.ApplyInventory(ctx, i, opts.Inventory); err != nil {
+		return result, fmt.Errorf("inventory apply failed, error: %w", err)
+	}
+
+	if len(staleObjects) > 0 {
+		SortForDeletion(staleObjects)
+		deleteSet, err := s.Manager.DeleteAll(ctx, staleObjects, ssa.DefaultDeleteOptions())
+		if err != nil {
+			return result, fmt.Errorf("prune failed, error: %w", err)
+		}
+		result.Deleted = deleteSet.Entries
+	}
+
+	return result, nil
+}
+
+// Plan contains the changes Reconcile would make.
+type Plan struct {
+	// Created are the objects that would be created.
+	Created []ssa.ChangeSetEntry
+
+	// Updated are the existing objects that would be modified.
+	Updated []ssa.ChangeSetEntry
+
+	// Unchanged are the existing objects already in the desired state.
+	Unchanged []ssa.ChangeSetEntry
+
+	// Deleted are the stale objects that would be removed from the cluster.
+	Deleted []ssa.ChangeSetEntry
+}
+
+// PlanReconcile returns the changes Reconcile would make for the given objects and options, without
+// mutating the cluster, the stored inventory or the given arguments. The objects are classified with
+// server-side apply dry-runs, hence custom resources whose definitions aren't yet installed
+// result in an error.
+func (s *Storage) PlanReconcile(ctx context.Context, i *Inventory, objects []*unstructured.Unstructured, opts ReconcileOptions) (*Plan, error) {
+	desired := i.DeepCopy()
+	desired.Resources = []Resource{}
+	if err := desired.AddObjects(append([]*unstructured.Unstructured{}, objects...)); err != nil {
+		return nil, fmt.Errorf("creating inventory failed, error: %w", err)
+	}
+
+	staleObjects, err := s.GetInventoryStaleObjects(ctx, desired, opts.Prune)
+	if err != nil {
+		return nil, fmt.Errorf("inventory query failed, error: %w", err)
+	}
+
+	copies := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		copies = append(copies, obj.DeepCopy())
+	}
+	s.Manager.SetOwnerLabels(copies, i.Name, i.Namespace)
+	if opts.InventoryLabels {
+		s.SetInventoryLabels(copies, i)
+	}
+	if opts.SourceAnnotations {
+		s.SetSourceAnnotations(copies, i)
+	}
+	sort.Sort(ssa.SortableUnstructureds(copies))
+
+	plan := &Plan{}
+	for _, obj := range copies {
+		entry, _, _, err := s.Manager.Diff(ctx, obj, ssa.DefaultDiffOptions())
+		if err != nil {
+			return nil, err
+		}
+		switch entry.Action {
+		case string(ssa.CreatedAction):
+			plan.Created = append(plan.Created, *entry)
+		case string(ssa.UnchangedAction):
+			plan.Unchanged = append(plan.Unchanged, *entry)
+		default:
+			plan.Updated = append(plan.Updated, *entry)
+		}
+	}
+
+	SortForDeletion(staleObjects)
+	for _, obj := range staleObjects {
+		plan.Deleted = append(plan.Deleted, ssa.ChangeSetEntry{
+			ObjMetadata:  object.UnstructuredToObjMetadata(obj),
+			GroupVersion: obj.GroupVersionKind().GroupVersion().String(),
+			Subject:      ssa.FmtUnstructured(obj),
+			Action:       string(ssa.DeletedAction),
+		})
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_Reconcile(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		g.Expect(unstructured.SetNestedField(obj.Object, "value", "data", "key")).To(Succeed())
+		return obj
+	}
+
+	result, err := s.Reconcile(ctx, NewInventory("test", "default"),
+		[]*unstructured.Unstructured{newConfigMap("a"), newConfigMap("b")}, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Created).To(HaveLen(2))
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Resources).To(HaveLen(2))
+
+	result, err = s.Reconcile(ctx, NewInventory("test", "default"),
+		[]*unstructured.Unstructured{newConfigMap("a")}, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Deleted).To(HaveLen(1))
+	g.Expect(result.Deleted[0].ObjMetadata.Name).To(Equal("b"))
+
+	err = s.Manager.Client().Get(ctx, client.ObjectKey{Name: "b", Namespace: "default"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Resources).To(HaveLen(1))
+}
+
+func TestStorage_ReconcileInventoryLabels(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	obj.SetName("a")
+	obj.SetNamespace("default")
+
+	inv := NewInventory("test", "apps")
+	_, err := s.Reconcile(ctx, inv, []*unstructured.Unstructured{obj}, ReconcileOptions{InventoryLabels: true})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "a", Namespace: "default"}, live)).To(Succeed())
+	g.Expect(live.GetLabels()).To(HaveKeyWithValue(testOwner.Group+"/inventory-name", "test"))
+	g.Expect(live.GetLabels()).To(HaveKeyWithValue(testOwner.Group+"/inventory-namespace", "apps"))
+
+	owner, err := s.FindOwningInventory(ctx, live)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(owner.Name).To(Equal("test"))
+}
+
+func TestStorage_PlanReconcile(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		return obj
+	}
+
+	objects := []*unstructured.Unstructured{newConfigMap("b"), newConfigMap("a")}
+	plan, err := s.PlanReconcile(ctx, NewInventory("test", "default"), objects, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan.Created).To(HaveLen(2))
+	g.Expect(plan.Deleted).To(BeEmpty())
+	g.Expect(objects[0].GetName()).To(Equal("b"))
+	g.Expect(objects[0].GetLabels()).To(BeEmpty())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrInventoryNotFound))
+
+	_, err = s.Reconcile(ctx, NewInventory("test", "default"), objects, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	plan, err = s.PlanReconcile(ctx, NewInventory("test", "default"), []*unstructured.Unstructured{newConfigMap("a")}, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan.Deleted).To(HaveLen(1))
+	g.Expect(plan.Deleted[0].ObjMetadata.Name).To(Equal("b"))
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "b", Namespace: "default"}, &corev1.ConfigMap{})).To(Succeed())
+}
+
+func TestStorage_PlanReconcileOptions(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		return obj
+	}
+
+	opts := ReconcileOptions{
+		InventoryLabels: true,
+		Prune: PruneOptions{
+			Exclusions: []Exclusion{{GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"), Name: "b"}},
+		},
+	}
+	objects := []*unstructured.Unstructured{newConfigMap("a"), newConfigMap("b"), newConfigMap("c")}
+	_, err := s.Reconcile(ctx, NewInventory("test", "default"), objects, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	plan, err := s.PlanReconcile(ctx, NewInventory("test", "default"), []*unstructured.Unstructured{newConfigMap("a")}, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan.Deleted).To(HaveLen(1))
+	g.Expect(plan.Deleted[0].ObjMetadata.Name).To(Equal("c"))
+
+	plan, err = s.PlanReconcile(ctx, NewInventory("test", "default"), []*unstructured.Unstructured{newConfigMap("a")}, ReconcileOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan.Deleted).To(HaveLen(2))
+}
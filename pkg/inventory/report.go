@@ -0,0 +1,133 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// ObjectState is the cluster state of an inventory entry.
+type ObjectState string
+
+const (
+	// ObjectPresent is the state of the objects that exist in the cluster and haven't drifted.
+	ObjectPresent ObjectState = "Present"
+
+	// ObjectMissing is the state of the objects that don't exist in the cluster.
+	ObjectMissing ObjectState = "Missing"
+
+	// ObjectDrifted is the state of the objects whose live digest differs from the recorded one.
+	ObjectDrifted ObjectState = "Drifted"
+)
+
+// ObjectReport is the cluster state of an inventory entry.
+type ObjectReport struct {
+	// Entry is the inventory entry.
+	Entry Resource `json:"entry"`
+
+	// State is the cluster state of the entry object.
+	State ObjectState `json:"state"`
+}
+
+// InventoryReport is the cluster state of the objects tracked by an inventory.
+type InventoryReport struct {
+	// Name is the inventory name.
+	Name string `json:"name"`
+
+	// Namespace is the inventory namespace.
+	Namespace string `json:"namespace"`
+
+	// Present is the number of objects in the ObjectPresent state.
+	Present int `json:"present"`
+
+	// Missing is the number of objects in the ObjectMissing state.
+	Missing int `json:"missing"`
+
+	// Drifted is the number of objects in the ObjectDrifted state.
+	Drifted int `json:"drifted"`
+
+	// Objects contains the state of each entry, in apply order.
+	Objects []ObjectReport `json:"objects"`
+}
+
+// Report returns the cluster state of the objects recorded in the stored inventory. Each entry
+// is classified as missing if its object doesn't exist, as drifted if the entry has a digest that
+// differs from the digest of the fields applied by the owner to the live object, or else as
+// present. Objects of kinds unknown to the cluster are reported as missing. The lookups are made
+// in parallel using the resource manager client.
+func (s *Storage) Report(ctx context.Context, i *Inventory) (*InventoryReport, error) {
+	stored := NewInventory(i.Name, i.Namespace)
+	if err := s.GetInventory(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	objects, err := stored.ListObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]Resource, len(stored.Resources))
+	for _, entry := range stored.Resources {
+		entries[entry.ObjectID] = entry
+	}
+
+	report := &InventoryReport{
+		Name:      stored.Name,
+		Namespace: stored.Namespace,
+		Objects:   make([]ObjectReport, len(objects)),
+	}
+	err = s.forEach(ctx, len(objects), func(ctx context.Context, n int) error {
+		entry := entries[object.UnstructuredToObjMetadata(objects[n]).String()]
+		live, err := s.liveObject(ctx, objects[n])
+		if err != nil {
+			return err
+		}
+
+		state := ObjectPresent
+		switch {
+		case live == nil:
+			state = ObjectMissing
+		case entry.Digest != "":
+			digest, err := ManagedObjectDigest(live, s.Owner.Field)
+			if err != nil {
+				return err
+			}
+			if digest != entry.Digest {
+				state = ObjectDrifted
+			}
+		}
+		report.Objects[n] = ObjectReport{Entry: entry, State: state}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range report.Objects {
+		switch obj.State {
+		case ObjectPresent:
+			report.Present++
+		case ObjectMissing:
+			report.Missing++
+		case ObjectDrifted:
+			report.Drifted++
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_Report(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	var objects []*unstructured.Unstructured
+	for _, name := range []string{"a", "b", "c"} {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		g.Expect(unstructured.SetNestedField(obj.Object, "1", "data", "key")).To(Succeed())
+		objects = append(objects, obj)
+	}
+	_, err := s.Manager.ApplyAll(ctx, objects, ssa.DefaultApplyOptions())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	inv := NewInventory("test", "default")
+	g.Expect(inv.AddObjects(objects)).To(Succeed())
+	g.Expect(s.RecordObjectDigests(ctx, inv, objects)).To(Succeed())
+	inv.Resources[0].Digest = ""
+	inv.Resources = append(inv.Resources, Resource{ObjectID: "default_gone__ConfigMap", ObjectVersion: "v1"})
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	// fields set by other controllers aren't drift
+	b := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "b", Namespace: "default"}, b)).To(Succeed())
+	b.Annotations = map[string]string{"example.com/observed": "true"}
+	g.Expect(s.Manager.Client().Update(ctx, b)).To(Succeed())
+
+	c := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "c", Namespace: "default"}, c)).To(Succeed())
+	c.Data["key"] = "2"
+	g.Expect(s.Manager.Client().Update(ctx, c)).To(Succeed())
+
+	report, err := s.Report(ctx, NewInventory("test", "default"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Present).To(Equal(2))
+	g.Expect(report.Missing).To(Equal(1))
+	g.Expect(report.Drifted).To(Equal(1))
+
+	states := make(map[string]ObjectState)
+	for _, obj := range report.Objects {
+		states[obj.Entry.ObjectID] = obj.State
+	}
+	g.Expect(states).To(Equal(map[string]ObjectState{
+		"default_a__ConfigMap":    ObjectPresent,
+		"default_b__ConfigMap":    ObjectPresent,
+		"default_c__ConfigMap":    ObjectDrifted,
+		"default_gone__ConfigMap": ObjectMissing,
+	}))
+
+	_, err = s.Report(ctx, NewInventory("missing", "default"))
+	g.Expect(err).To(MatchError(ErrInventoryNotFound))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// RetryOptions contains the retry policy for transient storage write failures.
+// The zero value disables retries.
+type RetryOptions struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+
+	// Delay is the wait before the first retry, doubled on each subsequent retry.
+	Delay time.Duration
+}
+
+// DefaultRetryOptions is the retry policy used by NewStorage.
+var DefaultRetryOptions = RetryOptions{
+	Attempts: 5,
+	Delay:    500 * time.Millisecond,
+}
+
+// retry calls fn until it succeeds, returns a terminal error, the attempts are exhausted
+// or the context is cancelled. Conflicts are retried only for unguarded writes, as a write
+// guarded by a resource version fails with the same conflict on every attempt.
+func (s *Storage) retry(ctx context.Context, guarded bool, fn func() error) error {
+	delay := s.Retry.Delay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.Retry.Attempts || !isRetriable(err, guarded) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// isRetriable returns true for transient API errors.
+func isRetriable(err error, guarded bool) bool {
+	switch {
+	case apierrors.IsConflict(err):
+		return !guarded
+	case apierrors.IsTimeout(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsServiceUnavailable(err),
+		apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+// failingClient returns the given error for the first failures patch calls.
+type failingClient struct {
+	client.Client
+	err      error
+	failures int
+	calls    int
+}
+
+func (c *failingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.calls++
+	if c.calls <= c.failures {
+		return c.err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyInventory_Retry(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.Retry = RetryOptions{Attempts: 3, Delay: time.Millisecond}
+	ctx := context.Background()
+	inv := NewInventory("test", "default")
+
+	flaky := &failingClient{Client: s.Manager.Client(), err: apierrors.NewServiceUnavailable("unavailable"), failures: 2}
+	s.StorageClient = flaky
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(flaky.calls).To(Equal(3))
+
+	forbidden := &failingClient{Client: s.Manager.Client(), err: apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "test", nil), failures: 1}
+	s.StorageClient = forbidden
+	_, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(apierrors.IsForbidden(err)).To(BeTrue())
+	g.Expect(forbidden.calls).To(Equal(1))
+
+	s.Retry = RetryOptions{}
+	disabled := &failingClient{Client: s.Manager.Client(), err: apierrors.NewServiceUnavailable("unavailable"), failures: 1}
+	s.StorageClient = disabled
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(HaveOccurred())
+	g.Expect(disabled.calls).To(Equal(1))
+}
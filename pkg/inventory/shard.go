@@ -0,0 +1,246 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultMaxBytes is the default size limit of the inventory data stored in a single object.
+	DefaultMaxBytes = 900 * 1024
+
+	shardComponentExt = "-shard"
+	shardSuffix       = "-shard-"
+)
+
+// maxBytes returns the size limit of the inventory data stored in a single object.
+func (s *Storage) maxBytes() int {
+	if s.MaxBytes > 0 {
+		return s.MaxBytes
+	}
+	return DefaultMaxBytes
+}
+
+// EstimatedSize returns the size in bytes of the entries payload that ApplyInventory
+// would store for the given inventory, after compression and encryption if enabled.
+// A size greater than the shard limit means the inventory will be sharded.
+func (s *Storage) EstimatedSize(i *Inventory) (int, error) {
+	_, payload, err := s.encodeResources(i.Resources)
+	if err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// splitPayload splits the given value into chunks of at most max bytes.
+func splitPayload(value string, max int) []string {
+	if len(value) <= max {
+		return []string{value}
+	}
+
+	var chunks []string
+	for len(value) > max {
+		chunks = append(chunks, value[:max])
+		value = value[max:]
+	}
+	if len(value) > 0 {
+		chunks = append(chunks, value)
+	}
+	return chunks
+}
+
+func (s *Storage) shardsAnnotation() string {
+	return s.Owner.Group + "/shards"
+}
+
+func (s *Storage) shardsIDAnnotation() string {
+	return s.Owner.Group + "/shards-id"
+}
+
+func (s *Storage) shardIndexLabel() string {
+	return s.Owner.Group + "/shard"
+}
+
+func (s *Storage) shardIDLabel() string {
+	return s.Owner.Group + "/shard-id"
+}
+
+// shardsID returns the content address of the shards holding the given payload.
+func shardsID(payload string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(payload)))[:10]
+}
+
+// shardLabels returns the labels used to select the shards of the given storage object.
+func (s *Storage) shardLabels(parent client.Object) client.MatchingLabels {
+	return client.MatchingLabels{
+		s.nameLabel():      s.objectKeys(parent)[s.nameLabel()],
+		s.componentLabel(): s.objectKeys(parent)[s.componentLabel()] + shardComponentExt,
+		s.createdByLabel(): s.createdBy(),
+	}
+}
+
+// newShardObject returns the storage object holding the shard with the given index of the
+// given storage object, the first shard is stored in the storage object itself. The shards
+// are named '<name>-shard-<id>-<index>' after the content address of the payload, instead of
+// '<name>-<index>', so that a writer never overwrites the shards referenced by the stored object
+// with a different payload, and the names don't collide with the inventories named '<name>-<n>'.
+func (s *Storage) newShardObject(parent client.Object, id string, index int) client.Object {
+	keys := s.objectKeys(parent)
+	obj := s.newStorageObject(keys[s.nameLabel()], "")
+	obj.SetName(parent.GetName() + shardSuffix + id + "-" + strconv.Itoa(index))
+	obj.SetNamespace(parent.GetNamespace())
+
+	labels := make(map[string]string, len(parent.GetLabels()))
+	for k, v := range parent.GetLabels() {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+	s.setObjectKeys(obj, map[string]string{
+		s.inventoryNamespaceLabel(): keys[s.inventoryNamespaceLabel()],
+		s.componentLabel():          keys[s.componentLabel()] + shardComponentExt,
+		s.shardIndexLabel():         strconv.Itoa(index),
+		s.shardIDLabel():            id,
+	})
+	return obj
+}
+
+// applyShards writes the given chunks to the shards of the given storage object starting with index one.
+func (s *Storage) applyShards(ctx context.Context, parent client.Object, id, key string, chunks []string, dryRun bool, opts []client.PatchOption) error {
+	for n, chunk := range chunks {
+		shard := s.newShardObject(parent, id, n+1)
+		setStorageData(shard, map[string]string{key: chunk})
+		if err := s.patchStorageObject(ctx, shard, dryRun, opts); err != nil {
+			return fmt.Errorf("failed to apply %s/%s, error: %w", s.backendKind(), client.ObjectKeyFromObject(shard), err)
+		}
+	}
+	return nil
+}
+
+// listShards returns the shards of the given storage object, regardless of their content address.
+func (s *Storage) listShards(ctx context.Context, parent client.Object) ([]client.Object, error) {
+	objects, err := s.listStorageObjects(ctx, parent.GetNamespace(), s.shardLabels(parent))
+	if err != nil {
+		return nil, err
+	}
+
+	var shards []client.Object
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.GetName(), parent.GetName()+shardSuffix) {
+			shards = append(shards, obj)
+		}
+	}
+	return shards, nil
+}
+
+// pruneShards deletes the shards of the given storage object that don't have the given
+// content address, all the shards are deleted when the address is empty. It must be called
+// after the storage object is written, so that the stored object never points to missing shards.
+func (s *Storage) pruneShards(ctx context.Context, parent client.Object, id string) error {
+	shards, err := s.listShards(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		if id != "" && s.objectKeys(shard)[s.shardIDLabel()] == id {
+			continue
+		}
+		if err := s.client().Delete(ctx, shard); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s/%s, error: %w", s.backendKind(), client.ObjectKeyFromObject(shard), err)
+		}
+	}
+	return nil
+}
+
+// payloadKey returns the key holding the entries payload in the given data.
+func (s *Storage) payloadKey(data map[string]string) string {
+	if _, ok := data[s.dataKey()+compressedKeyExt]; ok {
+		return s.dataKey() + compressedKeyExt
+	}
+	return s.dataKey()
+}
+
+// readData returns the data of the given storage object, with the inventory
+// resources of a sharded inventory reassembled from all its shards.
+// When a verifier is set, the signature of the resources is verified.
+func (s *Storage) readData(ctx context.Context, obj client.Object) (map[string]string, error) {
+	data, err := s.assembleData(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifySignature(obj, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// assembleData returns the data of the given storage object, with the inventory
+// resources of a sharded inventory reassembled from all its shards.
+func (s *Storage) assembleData(ctx context.Context, obj client.Object) (map[string]string, error) {
+	data := getStorageData(obj)
+	count, err := strconv.Atoi(obj.GetAnnotations()[s.shardsAnnotation()])
+	if err != nil || count < 2 {
+		return data, nil
+	}
+
+	key := s.payloadKey(data)
+	shards, err := s.listShards(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	id := obj.GetAnnotations()[s.shardsIDAnnotation()]
+	if id == "" {
+		return nil, newCorruptError(fmt.Errorf("inventory shards address not found for %s/%s",
+			s.backendKind(), client.ObjectKeyFromObject(obj)))
+	}
+	chunks := make(map[int]string, len(shards))
+	for _, shard := range shards {
+		if s.objectKeys(shard)[s.shardIDLabel()] != id {
+			continue
+		}
+		if index, err := strconv.Atoi(s.objectKeys(shard)[s.shardIndexLabel()]); err == nil {
+			chunks[index] = getStorageData(shard)[key]
+		}
+	}
+
+	var value strings.Builder
+	value.WriteString(data[key])
+	for n := 1; n < count; n++ {
+		chunk, ok := chunks[n]
+		if !ok {
+			return nil, fmt.Errorf("inventory shard %d of %d not found for %s/%s",
+				n, count, s.backendKind(), client.ObjectKeyFromObject(obj))
+		}
+		value.WriteString(chunk)
+	}
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		result[k] = v
+	}
+	result[key] = value.String()
+	return result, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestApplyInventory_Shards(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.MaxBytes = 1024
+	ctx := context.Background()
+
+	countShards := func() int {
+		list := &corev1.ConfigMapList{}
+		g.Expect(s.Manager.Client().List(ctx, list, client.InNamespace("default"), s.shardLabels(s.newStorageObject("test", "default")))).To(Succeed())
+		return len(list.Items)
+	}
+
+	inv := NewInventory("test", "default")
+	for n := 0; n < 100; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(countShards()).To(BeNumerically(">", 1))
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(sortResources(inv.Resources)))
+
+	inventories, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inventories).To(HaveLen(1))
+	g.Expect(inventories[0].Resources).To(Equal(sortResources(inv.Resources)))
+
+	inv.Resources = inv.Resources[:1]
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(countShards()).To(Equal(0))
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	inv.Resources = result.Resources
+	for n := 1; n < 100; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	g.Expect(countShards()).To(Equal(0))
+}
+
+func TestApplyInventory_ShardsConflict(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.MaxBytes = 1024
+	ctx := context.Background()
+
+	newInventory := func(prefix string) *Inventory {
+		inv := NewInventory("test", "default")
+		for n := 0; n < 100; n++ {
+			inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_%s%d__ConfigMap", prefix, n), ObjectVersion: "v1"})
+		}
+		return inv
+	}
+
+	g.Expect(s.ApplyInventory(ctx, newInventory("a"), ApplyOptions{})).Error().To(Succeed())
+	stale := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stale)).To(Succeed())
+
+	current := newInventory("b")
+	g.Expect(s.ApplyInventory(ctx, current, ApplyOptions{})).Error().To(Succeed())
+
+	stale.Resources = newInventory("c").Resources
+	_, err := s.ApplyInventory(ctx, stale, ApplyOptions{})
+	g.Expect(errors.Is(err, ErrInventoryConflict)).To(BeTrue())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(sortResources(current.Resources)))
+
+	// the shards left by the stale writer are pruned by the next apply
+	g.Expect(s.ApplyInventory(ctx, result, ApplyOptions{})).Error().To(Succeed())
+	cm, err := s.GetInventoryConfigMap(ctx, result)
+	g.Expect(err).ToNot(HaveOccurred())
+	shards, err := s.listShards(ctx, cm)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(shards).ToNot(BeEmpty())
+	for _, shard := range shards {
+		g.Expect(shard.GetLabels()).To(HaveKeyWithValue(s.shardIDLabel(), cm.GetAnnotations()[s.shardsIDAnnotation()]))
+	}
+}
+
+func TestStorage_EstimatedSize(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	for n := 0; n < 100; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm-%d__ConfigMap", n), ObjectVersion: "v1"})
+	}
+
+	for _, compress := range []bool{false, true} {
+		s.Compress = compress
+		size, err := s.EstimatedSize(inv)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+		cm, err := s.GetInventoryConfigMap(ctx, inv)
+		g.Expect(err).ToNot(HaveOccurred())
+		key, _, err := s.encodeResources(inv.Resources)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cm.Data[key]).To(HaveLen(size))
+	}
+}
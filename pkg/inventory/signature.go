@@ -0,0 +1,119 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Signer signs the inventory payload.
+type Signer interface {
+	// Sign returns the signature of the given payload.
+	Sign(payload []byte) ([]byte, error)
+}
+
+// Verifier verifies the signature of the inventory payload.
+type Verifier interface {
+	// Verify returns an error if the signature isn't valid for the given payload.
+	Verify(payload, signature []byte) error
+}
+
+// HMACSigner is a Signer and Verifier using HMAC-SHA256 with a shared key.
+type HMACSigner struct {
+	Key []byte
+}
+
+var (
+	_ Signer   = HMACSigner{}
+	_ Verifier = HMACSigner{}
+)
+
+// Sign returns the HMAC-SHA256 of the given payload.
+func (h HMACSigner) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, h.Key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+// Verify returns an error if the signature isn't the HMAC-SHA256 of the given payload.
+func (h HMACSigner) Verify(payload, signature []byte) error {
+	expected, _ := h.Sign(payload)
+	if !hmac.Equal(expected, signature) {
+		return errors.New("invalid HMAC")
+	}
+	return nil
+}
+
+// signatureAnnotation returns the annotation holding the signature of the inventory payload.
+func (s *Storage) signatureAnnotation() string {
+	return s.Owner.Group + "/signature"
+}
+
+// signedPayload returns the given payload bound to the namespace and name of the storage object,
+// so that a signed payload copied to another object fails the verification.
+func signedPayload(obj client.Object, payload string) []byte {
+	return []byte(obj.GetNamespace() + "/" + obj.GetName() + "\n" + payload)
+}
+
+// sign adds the signature of the given payload of the storage object to the annotations,
+// when a signer is set.
+func (s *Storage) sign(obj client.Object, annotations map[string]string, payload string) error {
+	if s.Signer == nil {
+		return nil
+	}
+	signature, err := s.Signer.Sign(signedPayload(obj, payload))
+	if err != nil {
+		return fmt.Errorf("failed to sign inventory data, error: %w", err)
+	}
+	annotations[s.signatureAnnotation()] = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// verifySignature verifies the signature of the resources payload in the given storage data,
+// when a verifier is set. It returns an error matching ErrSignatureMismatch if the signature
+// is missing or invalid.
+func (s *Storage) verifySignature(obj client.Object, data map[string]string) error {
+	if s.Verifier == nil {
+		return nil
+	}
+	payload, ok := data[s.dataKey()+compressedKeyExt]
+	if !ok {
+		if payload, ok = data[s.dataKey()]; !ok {
+			return nil
+		}
+	}
+
+	objKey := client.ObjectKeyFromObject(obj)
+	value, ok := obj.GetAnnotations()[s.signatureAnnotation()]
+	if !ok {
+		return newSignatureError(fmt.Errorf("%s/%s is not signed", s.backendKind(), objKey))
+	}
+	signature, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return newSignatureError(fmt.Errorf("%s/%s has an invalid signature, error: %w", s.backendKind(), objKey, err))
+	}
+	if err := s.Verifier.Verify(signedPayload(obj, payload), signature); err != nil {
+		return newSignatureError(fmt.Errorf("%s/%s signature verification failed, error: %w", s.backendKind(), objKey, err))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_Signature(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+	signer := HMACSigner{Key: []byte("secret")}
+	s.Signer = signer
+	s.Verifier = signer
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+	g.Expect(result.Metadata).To(BeEmpty())
+
+	s.Verifier = HMACSigner{Key: []byte("other")}
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrSignatureMismatch))
+	s.Verifier = signer
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(s.newStorageObject("test", "default")), cm)).To(Succeed())
+	cm.Data[resourcesKey] = `{"version":1,"entries":[]}`
+	g.Expect(s.Manager.Client().Update(ctx, cm)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrSignatureMismatch))
+
+	delete(cm.Annotations, s.signatureAnnotation())
+	g.Expect(s.Manager.Client().Update(ctx, cm)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrSignatureMismatch))
+
+	s.Verifier = nil
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(Succeed())
+}
+
+func TestStorage_SignatureBinding(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.HistoryLimit = 5
+	ctx := context.Background()
+	signer := HMACSigner{Key: []byte("secret")}
+	s.Signer = signer
+	s.Verifier = signer
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	inv.SetSource("oci://registry/app", "1.0.1", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, NewInventory("other", "default"), ApplyOptions{})).Error().To(Succeed())
+
+	// a signed payload copied to another inventory doesn't verify
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	other, err := s.GetInventoryConfigMap(ctx, NewInventory("other", "default"))
+	g.Expect(err).ToNot(HaveOccurred())
+	other.Data = cm.Data
+	other.Annotations[s.signatureAnnotation()] = cm.Annotations[s.signatureAnnotation()]
+	g.Expect(s.Manager.Client().Update(ctx, other)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, NewInventory("other", "default"))).To(MatchError(ErrSignatureMismatch))
+	_, err = s.InventoryFromConfigMap(other)
+	g.Expect(err).To(MatchError(ErrSignatureMismatch))
+	g.Expect(s.InventoryFromConfigMap(cm)).Error().To(Succeed())
+
+	// the history is verified on restore and re-signed on move
+	g.Expect(s.MoveInventory(ctx, inv, "moved", "apps")).To(Succeed())
+	moved := NewInventory("moved", "apps")
+	g.Expect(s.RestoreRevision(ctx, moved, "1.0.0")).To(Succeed())
+
+	history, err := s.listHistoryObjects(ctx, moved)
+	g.Expect(err).ToNot(HaveOccurred())
+	tampered := history[0].(*corev1.ConfigMap)
+	tampered.Data[resourcesKey] = `{"version":1,"entries":[]}`
+	g.Expect(s.Manager.Client().Update(ctx, tampered)).To(Succeed())
+	revision := tampered.GetAnnotations()[testOwner.Group+"/revision"]
+	g.Expect(s.RestoreRevision(ctx, moved, revision)).To(MatchError(ErrSignatureMismatch))
+}
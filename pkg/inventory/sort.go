@@ -0,0 +1,78 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// SortForDeletion sorts the given objects in the reverse of the apply order, so that
+// the objects inside a namespace are deleted before the namespace and the custom resources
+// before their definitions. Objects of the same kind are sorted by namespace and name.
+func SortForDeletion(objects []*unstructured.Unstructured) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		first := object.UnstructuredToObjMetadata(objects[i])
+		second := object.UnstructuredToObjMetadata(objects[j])
+		if !ssa.Equals(first.GroupKind, second.GroupKind) {
+			return ssa.IsLessThan(second.GroupKind, first.GroupKind)
+		}
+		if first.Namespace != second.Namespace {
+			return first.Namespace < second.Namespace
+		}
+		return first.Name < second.Name
+	})
+}
+
+// sortResources returns a copy of the given entries sorted by namespace, group, kind and name.
+// Entries with an invalid object ID are sorted after the valid ones by ID.
+func sortResources(resources []Resource) []Resource {
+	type sortKey struct {
+		valid bool
+		meta  object.ObjMetadata
+	}
+
+	keys := make(map[string]sortKey, len(resources))
+	for _, entry := range resources {
+		meta, err := object.ParseObjMetadata(entry.ObjectID)
+		keys[entry.ObjectID] = sortKey{valid: err == nil, meta: meta}
+	}
+
+	sorted := make([]Resource, len(resources))
+	copy(sorted, resources)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := keys[sorted[i].ObjectID], keys[sorted[j].ObjectID]
+		switch {
+		case a.valid != b.valid:
+			return a.valid
+		case !a.valid:
+			return sorted[i].ObjectID < sorted[j].ObjectID
+		case a.meta.Namespace != b.meta.Namespace:
+			return a.meta.Namespace < b.meta.Namespace
+		case a.meta.GroupKind.Group != b.meta.GroupKind.Group:
+			return a.meta.GroupKind.Group < b.meta.GroupKind.Group
+		case a.meta.GroupKind.Kind != b.meta.GroupKind.Kind:
+			return a.meta.GroupKind.Kind < b.meta.GroupKind.Kind
+		default:
+			return a.meta.Name < b.meta.Name
+		}
+	})
+	return sorted
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSortForDeletion(t *testing.T) {
+	g := NewWithT(t)
+
+	newObject := func(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		return u
+	}
+
+	objects := []*unstructured.Unstructured{
+		newObject("v1", "Namespace", "", "test"),
+		newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com"),
+		newObject("v1", "ConfigMap", "test", "b"),
+		newObject("example.com/v1", "Widget", "test", "w"),
+		newObject("v1", "ConfigMap", "test", "a"),
+		newObject("apps/v1", "Deployment", "test", "d"),
+	}
+	SortForDeletion(objects)
+
+	var names []string
+	for _, u := range objects {
+		names = append(names, u.GetKind()+"/"+u.GetName())
+	}
+	g.Expect(names).To(Equal([]string{
+		"Widget/w",
+		"Deployment/d",
+		"ConfigMap/a",
+		"ConfigMap/b",
+		"Namespace/test",
+		"CustomResourceDefinition/widgets.example.com",
+	}))
+}
+
+func TestApplyInventory_SortedEntries(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "web_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "apps_b__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "apps_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "apps_a__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal([]Resource{inv.Resources[3], inv.Resources[1], inv.Resources[2], inv.Resources[0]}))
+
+	s.PreserveOrder = true
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+}
@@ -18,16 +18,29 @@ package inventory
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fluxcd/pkg/ssa"
+	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -37,144 +50,1263 @@ const (
 	nameLabelKey      = "app.kubernetes.io/name"
 	componentLabelKey = "app.kubernetes.io/component"
 	createdByLabelKey = "app.kubernetes.io/created-by"
+
+	deletionPollInterval   = 2 * time.Second
+	immutableApplyAttempts = 3
+)
+
+// StorageBackend is the kind of Kubernetes object used to store the inventory.
+type StorageBackend string
+
+const (
+	// ConfigMapBackend stores the inventory in a ConfigMap.
+	ConfigMapBackend StorageBackend = "ConfigMap"
+
+	// SecretBackend stores the inventory in a Secret.
+	SecretBackend StorageBackend = "Secret"
 )
 
-// Storage manages the Inventory in-cluster storage.
-type Storage struct {
-	Manager *ssa.ResourceManager
-	Owner   ssa.Owner
+// EventRecorder records the mutations of the inventory storage.
+type EventRecorder interface {
+	// Record is called after a successful mutation with the action name,
+	// the inventory name and namespace, and the number of inventory entries.
+	Record(action, name, namespace string, count int)
+}
+
+const (
+	// ApplyAction is the action recorded when an inventory is applied.
+	ApplyAction = "apply"
+
+	// DeleteAction is the action recorded when an inventory is deleted.
+	DeleteAction = "delete"
+)
+
+// Storage manages the Inventory in-cluster storage.
+// A Storage holds no mutable state and is safe for concurrent use by multiple goroutines,
+// provided that its fields aren't modified after the first use and that the configured
+// clients, recorder and encryptor are themselves safe for concurrent use.
+type Storage struct {
+	// Manager is the resource manager of the cluster where the inventory objects are applied.
+	Manager *ssa.ResourceManager
+	Owner   ssa.Owner
+
+	// StorageClient is the client used to read and write the inventory storage objects,
+	// defaults to the Manager client. Setting it allows storing the inventory in a different
+	// cluster than the one where the tracked objects live, e.g. on a management cluster.
+	// The REST mapping of the tracked objects is always resolved with the Manager client,
+	// and the stale objects are computed from the stored entries only.
+	StorageClient client.Client
+
+	// Backend is the kind of object used to store the inventory, defaults to ConfigMap.
+	Backend StorageBackend
+
+	// ExtraLabels are added to the storage object, they can't override the kustomizer labels.
+	ExtraLabels map[string]string
+
+	// Labels replaces all the labels of the storage objects when not nil, including the kustomizer,
+	// extra and name mapper labels, for clusters whose label policies allow only specific labels.
+	// The keys identifying the storage objects are then stored in '<group>/' annotations, and the
+	// objects are listed with the given labels and filtered by their annotations, hence at least
+	// one label is required. Changing this setting strands the inventories stored with the
+	// previous labels.
+	Labels map[string]string
+
+	// ExtraAnnotations are added to the storage object, the keys under the owner group
+	// are reserved for the kustomizer annotations and rejected by ApplyInventory.
+	ExtraAnnotations map[string]string
+
+	// Immutable marks the storage object as immutable. When the inventory data changes,
+	// the existing immutable object is deleted and recreated instead of patched.
+	Immutable bool
+
+	// DataKey is the key under which the inventory resources are stored, defaults to 'resources'.
+	// It must be a valid data key other than 'artifacts', ApplyInventory fails otherwise.
+	DataKey string
+
+	// Recorder is notified after each successful apply and delete, optional.
+	Recorder EventRecorder
+
+	// Compress enables gzip compression of the inventory resources when writing to storage.
+	// Both compressed and uncompressed inventories are read regardless of this setting.
+	Compress bool
+
+	// PrettyPrint indents the inventory JSON, useful when inspecting the storage object.
+	PrettyPrint bool
+
+	// MaxBytes is the size limit of the inventory data stored in a single object, defaults to DefaultMaxBytes.
+	// Larger inventories are split into shards stored in additional objects named '<name>-shard-<id>-<index>',
+	// where the id is the content address of the payload.
+	MaxBytes int
+
+	// Concurrency is the number of parallel cluster requests, defaults to DefaultConcurrency.
+	Concurrency int
+
+	// Retry is the retry policy for transient failures when writing the storage objects,
+	// the zero value disables retries.
+	Retry RetryOptions
+
+	// NamePrefix is prepended to the inventory name to form the storage object name, defaults to 'inv-'.
+	NamePrefix string
+
+	// NameSuffix is appended to the inventory name to form the storage object name, optional.
+	NameSuffix string
+
+	// DefaultNamespace is the namespace of the storage object for inventories without a namespace,
+	// e.g. releases made only of cluster-scoped objects. Changing it strands the inventories
+	// stored in the previous namespace, which must be migrated or deleted manually.
+	DefaultNamespace string
+
+	// NameMapper maps the inventories to their storage objects, defaults to a DefaultNameMapper
+	// configured with NamePrefix, NameSuffix and DefaultNamespace, which are ignored when it's set.
+	NameMapper NameMapper
+
+	// Metrics records the storage operations metrics, optional.
+	Metrics *Metrics
+
+	// Encryptor encrypts the inventory resources at rest, optional. Inventories flagged
+	// as encrypted can't be read without an encryptor.
+	Encryptor Encryptor
+
+	// Signer signs the inventory resources when writing to storage, optional.
+	// The signature covers the namespace and name of the storage object,
+	// and is stored in the '<group>/signature' annotation.
+	Signer Signer
+
+	// Verifier verifies the signature of the inventory resources when reading from storage, optional.
+	// Inventories without a valid signature can't be read when it's set.
+	Verifier Verifier
+
+	// Codec marshals and unmarshals the inventory data, defaults to the apimachinery JSON codec.
+	// The stored format is JSON regardless of the codec.
+	Codec Codec
+
+	// LenientDecoding makes GetInventory populate an inventory whose data can't be parsed with
+	// its metadata and no entries, instead of failing. The returned error still matches
+	// ErrCorruptInventory, the inventory can then be repaired by applying it.
+	LenientDecoding bool
+
+	// OperationTimeout bounds each API call made by the storage, zero means
+	// the calls are bounded only by the caller context.
+	OperationTimeout time.Duration
+
+	// HistoryLimit is the number of previous revisions kept for each inventory in objects
+	// named '<name>-history-<revision>', zero disables the history.
+	HistoryLimit int
+
+	// CreatedBy is the value of the created-by label of the storage objects, defaults to the owner field.
+	// Inventories are listed by this label, while the owner field remains the field manager.
+	CreatedBy string
+
+	// OwnerReference is set on the storage objects so that they are garbage collected
+	// when the owner is deleted, optional. The owner must be cluster-scoped or in the
+	// same namespace as the inventory.
+	OwnerReference *metav1.OwnerReference
+
+	// Now returns the current time used for the last applied time, defaults to time.Now.
+	Now func() time.Time
+
+	// StrictConflicts disables the forced ownership of the storage object fields, so that
+	// the fields managed by another field manager fail the apply with an error matching
+	// ErrInventoryConflict instead of being taken over. The last applied time refreshed by
+	// Touch is released by its field manager before each apply.
+	StrictConflicts bool
+
+	// PreserveOrder stores the inventory entries in the order they were added,
+	// by default the entries are sorted by namespace, kind and name.
+	PreserveOrder bool
+
+	// Version is the version of the tool applying the inventory, recorded
+	// in the '<group>/version' annotation when set.
+	Version string
+
+	// VerifyOwnership makes ApplyInventory fail with an error matching ErrOwnershipConflict
+	// when the storage object exists without the created-by label of this storage,
+	// instead of overwriting an object that shares the same name.
+	VerifyOwnership bool
+
+	// Logger receives debug logs for each apply, get and delete and error logs on failures,
+	// defaults to discarding the logs.
+	Logger logr.Logger
+}
+
+// ApplyOptions contains options for ApplyInventory.
+type ApplyOptions struct {
+	// CreateNamespace creates the inventory namespace if not present, the namespace is
+	// labeled with the created-by label of the inventory, or with the Labels when set.
+	CreateNamespace bool
+
+	// DryRun performs a server-side apply dry run, the API server validates
+	// the storage object without persisting it. When CreateNamespace is set and the
+	// namespace doesn't exist, only the namespace creation is validated, as the storage
+	// object can't be validated in a namespace that isn't persisted.
+	DryRun bool
+
+	// Validate checks the inventory entries before applying.
+	Validate bool
+
+	// Scope determines if a kind is namespaced when validating the entries,
+	// defaults to the REST mapper of the resource manager client.
+	Scope ScopeFunc
+
+	// FieldManager is the server-side apply field manager of the storage object,
+	// defaults to the owner field.
+	FieldManager string
+
+	// Attachments are stored as additional data keys of the storage object, e.g. a diff report
+	// or a provenance attestation. The keys must not collide with the inventory data keys.
+	// The attachments of the previous apply are replaced, while the storage operations that
+	// write back a stored inventory, e.g. AddEntries or RestoreRevision, keep them.
+	Attachments map[string]string
+
+	// TTL records an expiry time of the last applied time plus the given duration,
+	// after which the inventory is reported by ListExpired. Zero means no expiry.
+	// The storage operations that write back a stored inventory keep its expiry time.
+	TTL time.Duration
+
+	// expiresAt carries the expiry of the stored inventory over when the storage writes it back,
+	// it is ignored if TTL is set.
+	expiresAt string
+}
+
+// ApplyResult contains the outcome of ApplyInventory.
+type ApplyResult struct {
+	// Changed is true if the storage object was created or its data or metadata changed,
+	// the last applied time is not taken into account. Inventories encrypted with a
+	// non-deterministic cipher are always reported as changed.
+	Changed bool
+}
+
+// patchOptions returns the server-side apply options for the given apply options.
+func (s *Storage) patchOptions(opts ApplyOptions) []client.PatchOption {
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = s.Owner.Field
+	}
+
+	patchOpts := []client.PatchOption{
+		client.FieldOwner(fieldManager),
+	}
+	if !s.StrictConflicts {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	if opts.DryRun {
+		patchOpts = append(patchOpts, client.DryRunAll)
+	}
+	return patchOpts
+}
+
+// ApplyInventory creates or updates the storage object for the given inventory,
+// and reports whether the stored inventory changed. If the inventory has a resource
+// version set, e.g. by GetInventory, the apply fails with an error matching
+// ErrInventoryConflict when the storage object was modified in the meantime.
+func (s *Storage) ApplyInventory(ctx context.Context, i *Inventory, opts ApplyOptions) (result *ApplyResult, err error) {
+	defer func() {
+		s.Metrics.observeOperation(ApplyAction, s.storageNamespace(i.Name, i.Namespace), err)
+		s.logOperation(ApplyAction, i, err)
+	}()
+
+	if err := validateOwner(s.Owner); err != nil {
+		return nil, err
+	}
+
+	if opts.Validate {
+		scope := opts.Scope
+		if scope == nil {
+			scope = s.isNamespaced
+		}
+		if err := i.Validate(scope); err != nil {
+			return nil, fmt.Errorf("invalid inventory %s/%s, error: %w", i.Namespace, i.Name, err)
+		}
+	}
+
+	if err := s.validateDataKey(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateExtraAnnotations(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateLabels(); err != nil {
+		return nil, err
+	}
+
+	for k := range opts.Attachments {
+		if err := s.validateAttachmentKey(k); err != nil {
+			return nil, fmt.Errorf("invalid attachment for inventory %s/%s, error: %w", i.Namespace, i.Name, err)
+		}
+	}
+
+	key, resources, err := s.encodeResources(i.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	patchOpts := s.patchOptions(opts)
+
+	namespaceCreated := false
+	if opts.CreateNamespace {
+		namespaceCreated, err = s.createNamespace(ctx, s.storageNamespace(i.Name, i.Namespace), patchOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunks := splitPayload(resources, s.maxBytes())
+
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	annotations := s.metaToAnnotations(i)
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	if opts.TTL > 0 {
+		lastAppliedAt, _ := time.Parse(time.RFC3339, annotations[s.Owner.Group+"/last-applied-time"])
+		annotations[s.expiryAnnotation()] = lastAppliedAt.Add(opts.TTL).Format(time.RFC3339)
+	} else if opts.expiresAt != "" {
+		annotations[s.expiryAnnotation()] = opts.expiresAt
+	}
+	id := ""
+	if len(chunks) > 1 {
+		id = shardsID(resources)
+		annotations[s.shardsAnnotation()] = strconv.Itoa(len(chunks))
+		annotations[s.shardsIDAnnotation()] = id
+	}
+	if s.Encryptor != nil {
+		annotations[s.encryptedAnnotation()] = "true"
+	}
+	if err := s.sign(obj, annotations, resources); err != nil {
+		return nil, err
+	}
+	if errs := apivalidation.ValidateAnnotations(annotations, field.NewPath("metadata", "annotations")); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid inventory metadata %s/%s, error: %w", i.Namespace, i.Name, errs.ToAggregate())
+	}
+	obj.SetAnnotations(annotations)
+	obj.SetResourceVersion(i.ResourceVersion)
+
+	data := map[string]string{
+		key: chunks[0],
+	}
+
+	if len(i.Artifacts) > 0 {
+		artifacts, err := s.codec().Marshal(i.Artifacts)
+		if err != nil {
+			return nil, err
+		}
+		data[artifactsKey] = string(artifacts)
+	}
+	for k, v := range opts.Attachments {
+		data[k] = v
+	}
+	setStorageData(obj, data)
+
+	if namespaceCreated && opts.DryRun {
+		return &ApplyResult{Changed: true}, nil
+	}
+
+	if s.VerifyOwnership {
+		if err := s.verifyOwnership(ctx, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	var previous *Inventory
+	if s.HistoryLimit > 0 && !opts.DryRun {
+		if previous, err = s.previousRevision(ctx, i); err != nil {
+			return nil, err
+		}
+	}
+
+	changed, err := s.storageChanged(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// the shards are written first so that the inventory is never pointing to shards that
+	// don't exist, a stale writer leaves its shards behind to be pruned by the next apply
+	if err := s.applyShards(ctx, obj, id, key, chunks[1:], opts.DryRun, patchOpts); err != nil {
+		return nil, err
+	}
+
+	if s.StrictConflicts && !opts.DryRun {
+		if err := s.releaseTouch(ctx, obj, i); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.patchStorageObject(ctx, obj, opts.DryRun, patchOpts); err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, newConflictError(err)
+		}
+		return nil, err
+	}
+
+	if !opts.DryRun {
+		if err := s.clearAnnotations(ctx, obj, s.clearedAnnotations(i, obj)); err != nil {
+			return nil, err
+		}
+		i.Inactive = false
+		i.InactiveSince = ""
+		if err := s.pruneShards(ctx, obj, id); err != nil {
+			return nil, err
+		}
+		i.ResourceVersion = obj.GetResourceVersion()
+		if previous != nil {
+			if err := s.recordHistory(ctx, previous, patchOpts); err != nil {
+				return nil, err
+			}
+		}
+		s.record(ApplyAction, i)
+		s.Metrics.observeApply(s.storageNamespace(i.Name, i.Namespace), len(i.Resources), len(resources))
+	}
+	return &ApplyResult{Changed: changed}, nil
+}
+
+// clearedAnnotations returns the source and revision annotations left on the given
+// storage object while the corresponding inventory fields are empty, and the inactive
+// annotations, as applying an inventory activates it.
+func (s *Storage) clearedAnnotations(i *Inventory, obj client.Object) []string {
+	var keys []string
+	for key, value := range map[string]string{
+		s.Owner.Group + "/source":   i.Source,
+		s.Owner.Group + "/revision": i.Revision,
+		s.inactiveAnnotation():      "",
+		s.inactiveSinceAnnotation(): "",
+	} {
+		if _, ok := obj.GetAnnotations()[key]; ok && value == "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// clearAnnotations removes the given annotations from the storage object with a merge patch,
+// as annotations owned by other field managers aren't removed by server-side apply.
+func (s *Storage) clearAnnotations(ctx context.Context, obj client.Object, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	annotations := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		annotations[key] = nil
+	}
+	return s.patchAnnotations(ctx, obj, annotations)
+}
+
+// patchAnnotations sets the given annotations on the storage object with a merge patch,
+// annotations with a nil value are removed.
+func (s *Storage) patchAnnotations(ctx context.Context, obj client.Object, annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.client().Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+}
+
+// verifyOwnership returns an error if the given storage object exists and wasn't created by this storage.
+func (s *Storage) verifyOwnership(ctx context.Context, obj client.Object) error {
+	existing := &metav1.PartialObjectMetadata{}
+	existing.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(s.backendKind()))
+	if err := s.client().Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if createdBy := s.objectKeys(existing)[s.createdByLabel()]; createdBy != s.createdBy() {
+		return newOwnershipError(fmt.Errorf("%s/%s has the %s label '%s', expected '%s'",
+			s.backendKind(), client.ObjectKeyFromObject(obj), s.createdByLabel(), createdBy, s.createdBy()))
+	}
+	return nil
+}
+
+// storageChanged returns true if the given storage object differs from the stored one,
+// ignoring the last applied time and the expiry time derived from it. Setting or removing
+// the expiry is a change.
+func (s *Storage) storageChanged(ctx context.Context, obj client.Object) (bool, error) {
+	existing := s.emptyStorageObject()
+	if err := s.client().Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if !equalStorageData(getStorageData(existing), getStorageData(obj)) {
+		return true, nil
+	}
+
+	lastAppliedTime := s.Owner.Group + "/last-applied-time"
+	desired := obj.GetAnnotations()
+	for k, v := range desired {
+		if k == lastAppliedTime {
+			continue
+		}
+		current, ok := existing.GetAnnotations()[k]
+		if !ok || (current != v && k != s.expiryAnnotation()) {
+			return true, nil
+		}
+	}
+	for k := range existing.GetAnnotations() {
+		if _, ok := desired[k]; !ok && k != lastAppliedTime && strings.HasPrefix(k, s.Owner.Group+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// patchStorageObject applies the given storage object with server-side apply,
+// retrying on transient failures according to the retry policy.
+func (s *Storage) patchStorageObject(ctx context.Context, obj client.Object, dryRun bool, opts []client.PatchOption) error {
+	if s.Immutable {
+		setStorageImmutable(obj)
+	}
+	// field manager conflicts can't be resolved by retrying
+	guarded := obj.GetResourceVersion() != "" || s.StrictConflicts
+	return s.retry(ctx, guarded, func() error {
+		if s.Immutable {
+			return s.applyImmutable(ctx, obj, dryRun, opts)
+		}
+		return s.client().Patch(ctx, obj, client.Apply, opts...)
+	})
+}
+
+// applyImmutable applies the given immutable storage object. If the existing object is immutable
+// and its data differs, the object is deleted and recreated. When a concurrent writer deletes or
+// recreates the object in the meantime, the operation is retried with the latest object state,
+// unless the object carries a resource version, in which case a conflict error is returned.
+func (s *Storage) applyImmutable(ctx context.Context, obj client.Object, dryRun bool, opts []client.PatchOption) error {
+	objKey := client.ObjectKeyFromObject(obj)
+	resourceVersion := obj.GetResourceVersion()
+
+	var err error
+	for attempt := 0; attempt < immutableApplyAttempts; attempt++ {
+		existing := s.emptyStorageObject()
+		if err = s.client().Get(ctx, objKey, existing); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+		} else if isStorageImmutable(existing) && !equalStorageData(getStorageData(existing), getStorageData(obj)) {
+			if resourceVersion != "" && resourceVersion != existing.GetResourceVersion() {
+				return newConflictError(fmt.Errorf("%s/%s has been modified, resource version %s does not match %s",
+					s.backendKind(), objKey, resourceVersion, existing.GetResourceVersion()))
+			}
+
+			uid := existing.GetUID()
+			delOpts := []client.DeleteOption{
+				client.Preconditions{UID: &uid},
+			}
+			if dryRun {
+				// the data can't be changed in place, validate the deletion only
+				return s.client().Delete(ctx, existing, append(delOpts, client.DryRunAll)...)
+			}
+
+			if err = s.client().Delete(ctx, existing, delOpts...); err != nil {
+				if apierrors.IsConflict(err) && resourceVersion == "" {
+					continue
+				}
+				if !apierrors.IsNotFound(err) {
+					return fmt.Errorf("failed to delete immutable %s/%s, error: %w", s.backendKind(), objKey, err)
+				}
+			}
+			obj.SetResourceVersion("")
+		}
+
+		err = s.client().Patch(ctx, obj, client.Apply, opts...)
+		if err == nil {
+			return nil
+		}
+		// the object was recreated by another writer with different data
+		if !apierrors.IsInvalid(err) && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		if resourceVersion != "" {
+			return newConflictError(err)
+		}
+	}
+
+	return fmt.Errorf("failed to apply immutable %s/%s, error: %w", s.backendKind(), objKey, err)
+}
+
+// GetInventory retrieves the entries from the storage for the given inventory name and namespace.
+// It returns an error matching ErrInventoryNotFound if the storage object or the inventory data is missing.
+func (s *Storage) GetInventory(ctx context.Context, i *Inventory) (err error) {
+	defer func() {
+		s.Metrics.observeOperation(getOperation, s.storageNamespace(i.Name, i.Namespace), err)
+		s.logOperation(getOperation, i, err)
+	}()
+
+	obj, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.readData(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	return s.decodeInventory(i, obj, data)
+}
+
+// GetInventories fetches the inventories with the given names from the namespace in parallel,
+// and returns the inventories that were read successfully keyed by name, along with an error
+// for each inventory that couldn't be read. Inventories that don't exist are reported with an
+// error matching ErrInventoryNotFound.
+func (s *Storage) GetInventories(ctx context.Context, namespace string, names []string) (map[string]*Inventory, []error) {
+	inventories := make([]*Inventory, len(names))
+	errs := make([]error, len(names))
+	err := s.forEach(ctx, len(names), func(ctx context.Context, n int) error {
+		i := NewInventory(names[n], namespace)
+		if err := s.GetInventory(ctx, i); err != nil {
+			errs[n] = fmt.Errorf("failed to get inventory %s/%s, error: %w", namespace, names[n], err)
+			return nil
+		}
+		inventories[n] = i
+		return nil
+	})
+
+	result := make(map[string]*Inventory, len(names))
+	var failed []error
+	for n := range names {
+		switch {
+		case inventories[n] != nil:
+			result[names[n]] = inventories[n]
+		case errs[n] != nil:
+			failed = append(failed, errs[n])
+		case err != nil:
+			failed = append(failed, fmt.Errorf("failed to get inventory %s/%s, error: %w", namespace, names[n], err))
+		}
+	}
+	return result, failed
+}
+
+// GetInventoryMeta populates the source, revision, last applied time and entries count of the
+// given inventory, without fetching and decoding the entries. Only the storage object metadata
+// is fetched. It returns an error matching ErrInventoryNotFound if the storage object doesn't exist.
+func (s *Storage) GetInventoryMeta(ctx context.Context, i *Inventory) error {
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(s.backendKind()))
+	key := client.ObjectKeyFromObject(s.newStorageObject(i.Name, i.Namespace))
+	if err := s.client().Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+
+	s.metaFromAnnotations(i, obj.GetAnnotations())
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// GetAttachment returns the value of the given attachment stored with the inventory.
+// It returns an error matching ErrInventoryNotFound if the storage object or the attachment doesn't exist.
+func (s *Storage) GetAttachment(ctx context.Context, i *Inventory, key string) (string, error) {
+	if err := s.validateAttachmentKey(key); err != nil {
+		return "", err
+	}
+
+	obj, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := getStorageData(obj)[key]
+	if !ok {
+		return "", newNotFoundError(fmt.Errorf("attachment '%s' not found in %s/%s", key, s.backendKind(), client.ObjectKeyFromObject(obj)))
+	}
+	return value, nil
+}
+
+// validateAttachmentKey returns an error if the given key isn't a valid data key or is reserved for the inventory data.
+func (s *Storage) validateAttachmentKey(key string) error {
+	switch key {
+	case s.dataKey(), s.dataKey() + compressedKeyExt, artifactsKey:
+		return fmt.Errorf("key '%s' is reserved", key)
+	}
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return fmt.Errorf("key '%s' is invalid: %s", key, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateExtraAnnotations returns an error if an extra annotation is under the owner group,
+// as it could set a kustomizer annotation that the inventory leaves empty.
+func (s *Storage) validateExtraAnnotations() error {
+	for k := range s.ExtraAnnotations {
+		if strings.HasPrefix(k, s.Owner.Group+"/") {
+			return fmt.Errorf("invalid extra annotation '%s', the '%s/' prefix is reserved", k, s.Owner.Group)
+		}
+	}
+	return nil
+}
+
+// validateLabels returns an error if the labels override is empty, as the storage objects
+// would then be listed by selecting all the objects of their kind.
+func (s *Storage) validateLabels() error {
+	if s.Labels != nil && len(s.Labels) == 0 {
+		return fmt.Errorf("invalid labels, at least one label is required to select the storage objects")
+	}
+	return nil
+}
+
+// Touch refreshes the last applied time of the given inventory without rewriting its entries.
+// The annotation is applied with the '<owner>-touch' field manager, as a server-side apply patch
+// of the owner field manager containing only the annotation would remove the entries it owns.
+// The expiry recorded for the TTL of the last apply isn't refreshed.
+func (s *Storage) Touch(ctx context.Context, i *Inventory) error {
+	existing := &metav1.PartialObjectMetadata{}
+	existing.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(s.backendKind()))
+	key := client.ObjectKeyFromObject(s.newStorageObject(i.Name, i.Namespace))
+	if err := s.client().Get(ctx, key, existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+
+	lastAppliedAt := s.now().UTC().Format(time.RFC3339)
+	obj := s.newTouchObject(i)
+	obj.SetAnnotations(map[string]string{
+		s.Owner.Group + "/last-applied-time": lastAppliedAt,
+	})
+	// the resource version prevents recreating an object deleted in the meantime
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	err := s.client().Patch(ctx, obj, client.Apply, client.FieldOwner(s.touchFieldManager()), client.ForceOwnership)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		if apierrors.IsConflict(err) {
+			return newConflictError(err)
+		}
+		return err
+	}
+	i.LastAppliedAt = lastAppliedAt
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// touchFieldManager returns the field manager of the last applied time refreshed by Touch.
+func (s *Storage) touchFieldManager() string {
+	return s.Owner.Field + "-touch"
+}
+
+// newTouchObject returns the storage object of the given inventory without labels and data,
+// for the patches of the touch field manager.
+func (s *Storage) newTouchObject(i *Inventory) client.Object {
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	obj.SetLabels(nil)
+	obj.SetOwnerReferences(nil)
+	return obj
+}
+
+// releaseTouch removes the fields owned by the touch field manager from the given storage object,
+// so that an apply without forced ownership doesn't conflict with the last applied time refreshed
+// by Touch. When the object has a resource version, the release is guarded by it and the object
+// is given the resource version of the release, as the release is part of the caller's write.
+func (s *Storage) releaseTouch(ctx context.Context, obj client.Object, i *Inventory) error {
+	existing := &metav1.PartialObjectMetadata{}
+	existing.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(s.backendKind()))
+	if err := s.client().Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range existing.GetManagedFields() {
+		if entry.Manager == s.touchFieldManager() {
+			touch := s.newTouchObject(i)
+			resourceVersion := obj.GetResourceVersion()
+			if resourceVersion == "" {
+				resourceVersion = existing.GetResourceVersion()
+			}
+			touch.SetResourceVersion(resourceVersion)
+			if err := s.client().Patch(ctx, touch, client.Apply, client.FieldOwner(s.touchFieldManager())); err != nil {
+				if !apierrors.IsConflict(err) {
+					return err
+				}
+				if obj.GetResourceVersion() != "" {
+					return newConflictError(err)
+				}
+				return nil
+			}
+			if obj.GetResourceVersion() != "" {
+				obj.SetResourceVersion(touch.GetResourceVersion())
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// GetInventoryEntries decodes the entries of the given inventory one at a time and calls fn
+// for each of them, without holding all the entries in memory. The inventory metadata is
+// populated from the storage object, but not its resources. Returning ErrStop from fn
+// ends the iteration early without error.
+func (s *Storage) GetInventoryEntries(ctx context.Context, i *Inventory, fn func(Resource) error) error {
+	obj, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		return err
+	}
+	s.metaFromAnnotations(i, obj.GetAnnotations())
+	i.ResourceVersion = obj.GetResourceVersion()
+
+	r, err := s.openPayload(ctx, obj)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return streamResources(r, fn)
+}
+
+// GetInventoryRaw returns the stored entries payload of the given inventory without parsing it,
+// after reassembling the shards, decryption and decompression. It returns an error matching
+// ErrInventoryNotFound if the storage object or the inventory data is missing.
+func (s *Storage) GetInventoryRaw(ctx context.Context, i *Inventory) ([]byte, error) {
+	obj, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.openPayload(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// openPayload returns a reader of the decoded entries payload of the given storage object.
+func (s *Storage) openPayload(ctx context.Context, obj client.Object) (io.ReadCloser, error) {
+	data, err := s.readData(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	r, found, err := s.payloadReader(data, s.isEncrypted(obj))
+	if !found {
+		return nil, newNotFoundError(fmt.Errorf("inventory data '%s' not found in %s/%s", s.dataKey(), s.backendKind(), client.ObjectKeyFromObject(obj)))
+	}
+	return r, err
+}
+
+// GetInventoryConfigMap returns the live ConfigMap of the given inventory as stored in the cluster.
+// It returns an error matching ErrInventoryNotFound if the ConfigMap doesn't exist.
+func (s *Storage) GetInventoryConfigMap(ctx context.Context, i *Inventory) (*corev1.ConfigMap, error) {
+	if s.backendKind() != string(ConfigMapBackend) {
+		return nil, fmt.Errorf("inventory storage backend is %s", s.backendKind())
+	}
+
+	obj, err := s.getStorageObject(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*corev1.ConfigMap), nil
+}
+
+// InventoryFromConfigMap decodes the inventory stored in the given ConfigMap without reading from the cluster.
+// Sharded inventories can't be decoded offline as their entries are spread across multiple objects.
+// When a verifier is set, the signature is verified as for GetInventory.
+func (s *Storage) InventoryFromConfigMap(cm *corev1.ConfigMap) (*Inventory, error) {
+	if count, err := strconv.Atoi(cm.GetAnnotations()[s.shardsAnnotation()]); err == nil && count > 1 {
+		return nil, fmt.Errorf("inventory in ConfigMap %s is sharded in %d objects", client.ObjectKeyFromObject(cm), count)
+	}
+
+	if err := s.verifySignature(cm, getStorageData(cm)); err != nil {
+		return nil, err
+	}
+
+	i := NewInventory(s.inventoryName(cm), s.inventoryNamespace(cm))
+	if err := s.decodeInventory(i, cm, getStorageData(cm)); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ListInventories returns the inventories including their entries in the given namespace,
+// which is the namespace of the inventories and not of their storage objects. If the namespace
+// is empty, the inventories are listed across all namespaces. The options are optional, only the
+// first one is used.
+func (s *Storage) ListInventories(ctx context.Context, namespace string, opts ...ListOptions) ([]*Inventory, error) {
+	var inventories []*Inventory
+	objects, err := s.listStorageObjects(ctx, s.listNamespace(namespace), s.getOwnerLabels())
+	if err != nil {
+		return inventories, err
+	}
+
+	for _, obj := range objects {
+		if namespace != "" && s.inventoryNamespace(obj) != namespace {
+			continue
+		}
+		i := NewInventory(s.inventoryName(obj), s.inventoryNamespace(obj))
+		data, err := s.readData(ctx, obj)
+		if err != nil {
+			return inventories, err
+		}
+		if err := s.decodeInventory(i, obj, data); err != nil {
+			return inventories, err
+		}
+		inventories = append(inventories, i)
+	}
+
+	return listOptions(opts).filter(inventories), nil
+}
+
+// ListInventoriesMeta returns the inventories in the given namespace without their entries.
+// Only the storage objects metadata is fetched, the name, namespace, source, revision,
+// last applied time and entries count are populated from the object labels and annotations.
+// If the namespace is empty, the inventories are listed across all namespaces.
+// The options are optional, only the first one is used.
+func (s *Storage) ListInventoriesMeta(ctx context.Context, namespace string, opts ...ListOptions) ([]*Inventory, error) {
+	var inventories []*Inventory
+	if err := s.validateLabels(); err != nil {
+		return inventories, err
+	}
+	list := &metav1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(s.backendKind() + "List"))
+	err := s.client().List(ctx, list, client.InNamespace(s.listNamespace(namespace)), s.listSelector(s.getOwnerLabels()))
+	if err != nil {
+		return inventories, err
+	}
+
+	for n := range list.Items {
+		obj := &list.Items[n]
+		if !s.hasKeys(obj, s.getOwnerLabels()) {
+			continue
+		}
+		if namespace != "" && s.inventoryNamespace(obj) != namespace {
+			continue
+		}
+		i := NewInventory(s.inventoryName(obj), s.inventoryNamespace(obj))
+		s.metaFromAnnotations(i, obj.GetAnnotations())
+		i.ResourceVersion = obj.GetResourceVersion()
+		inventories = append(inventories, i)
+	}
+
+	return listOptions(opts).filter(inventories), nil
+}
+
+// DeleteInventory removes the storage for the given inventory name and namespace, including all its shards and history.
+func (s *Storage) DeleteInventory(ctx context.Context, i *Inventory) (err error) {
+	defer func() {
+		s.Metrics.observeOperation(DeleteAction, s.storageNamespace(i.Name, i.Namespace), err)
+		s.logOperation(DeleteAction, i, err)
+	}()
+
+	obj := s.newStorageObject(i.Name, i.Namespace)
+
+	objKey := client.ObjectKeyFromObject(obj)
+	err = s.client().Delete(ctx, obj)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s/%s, error: %w", s.backendKind(), objKey, err)
+	}
+	if err := s.pruneShards(ctx, obj, ""); err != nil {
+		return err
+	}
+	if err := s.deleteHistory(ctx, i); err != nil {
+		return err
+	}
+	s.record(DeleteAction, i)
+	return nil
 }
 
-// ApplyInventory creates or updates the storage object for the given inventory.
-func (s *Storage) ApplyInventory(ctx context.Context, i *Inventory, createNamespace bool) error {
-	resources, err := json.Marshal(i.Resources)
+// DeleteInventories removes the storage of the given inventories in parallel. All the deletions
+// are attempted and their errors are aggregated, inventories that don't exist are ignored.
+func (s *Storage) DeleteInventories(ctx context.Context, inventories []*Inventory) error {
+	errs := make([]error, len(inventories))
+	err := s.forEach(ctx, len(inventories), func(ctx context.Context, n int) error {
+		errs[n] = s.DeleteInventory(ctx, inventories[n])
+		return nil
+	})
 	if err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// DeleteInventoryAndWait removes the storage for the given inventory name and namespace,
+// then waits for the storage object to be removed from the cluster until the timeout expires.
+func (s *Storage) DeleteInventoryAndWait(ctx context.Context, i *Inventory, timeout time.Duration) error {
+	if err := s.DeleteInventory(ctx, i); err != nil {
 		return err
 	}
 
-	if createNamespace {
-		if err := s.createNamespace(ctx, i.Namespace); err != nil {
-			return err
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	objKey := client.ObjectKeyFromObject(obj)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollImmediateUntilWithContext(waitCtx, deletionPollInterval, func(ctx context.Context) (bool, error) {
+		err := s.client().Get(ctx, objKey, obj)
+		if apierrors.IsNotFound(err) {
+			return true, nil
 		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timeout waiting for %s/%s to be deleted, error: %w", s.backendKind(), objKey, err)
 	}
+	return nil
+}
 
-	cm := s.newConfigMap(i.Name, i.Namespace)
-	cm.Annotations = s.metaToAnnotations(i)
+// DeleteInventoryAndObjects deletes the objects tracked by the stored inventory in reverse apply order,
+// then removes the storage of the inventory, and returns the objects that were deleted. Objects and
+// inventories that don't exist are ignored. If any object fails to be deleted, the inventory storage
+// is kept so that the operation can be retried.
+func (s *Storage) DeleteInventoryAndObjects(ctx context.Context, i *Inventory) ([]*unstructured.Unstructured, error) {
+	stored := NewInventory(i.Name, i.Namespace)
+	if err := s.GetInventory(ctx, stored); err != nil {
+		if errors.Is(err, ErrInventoryNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
 
-	cm.Data = map[string]string{
-		"resources": string(resources),
+	objects, err := stored.ListObjects()
+	if err != nil {
+		return nil, err
 	}
+	SortForDeletion(objects)
 
-	if len(i.Artifacts) > 0 {
-		artifacts, err := json.Marshal(i.Artifacts)
+	var deleted []*unstructured.Unstructured
+	var errs []error
+	for _, obj := range objects {
+		exists, err := s.objectExists(ctx, obj)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		entry, err := s.Manager.Delete(ctx, obj, ssa.DefaultDeleteOptions())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if entry.Action == string(ssa.DeletedAction) {
+			deleted = append(deleted, obj)
+		}
+	}
+	if len(errs) > 0 {
+		return deleted, utilerrors.NewAggregate(errs)
+	}
+
+	return deleted, s.DeleteInventory(ctx, i)
+}
+
+// GetInventoryStaleObjects returns the list of objects metadata subject to pruning,
+// without the objects matched by the prune options exclusions.
+func (s *Storage) GetInventoryStaleObjects(ctx context.Context, i *Inventory, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	reader := *s
+	reader.StorageClient = withReadOptions(s.storageClient(), opts.Read)
+	return staleObjects(ctx, reader.GetInventory, i, opts)
+}
+
+// staleObjects returns the objects of the inventory read with get that are missing from the given inventory,
+// it's shared by the storage backends.
+func staleObjects(ctx context.Context, get func(context.Context, *Inventory) error, i *Inventory, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	objects := make([]*unstructured.Unstructured, 0)
+	existingInventory := NewInventory(i.Name, i.Namespace)
+	if err := get(ctx, existingInventory); err != nil {
+		if errors.Is(err, ErrInventoryNotFound) {
+			return objects, nil
 		}
-		cm.Data["artifacts"] = string(artifacts)
+		return nil, err
 	}
 
-	opts := []client.PatchOption{
-		client.ForceOwnership,
-		client.FieldOwner(s.Owner.Field),
+	objects, err := existingInventory.diff(i, opts.Progress)
+	if err != nil {
+		return nil, err
 	}
-	return s.Manager.Client().Patch(ctx, cm, client.Apply, opts...)
+
+	return opts.Filter(objects), nil
 }
 
-// GetInventory retrieves the entries from the storage for the given inventory name and namespace.
-func (s *Storage) GetInventory(ctx context.Context, i *Inventory) error {
-	cm := s.newConfigMap(i.Name, i.Namespace)
+// getStorageObject fetches the storage object of the given inventory.
+func (s *Storage) getStorageObject(ctx context.Context, i *Inventory) (client.Object, error) {
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	if err := s.client().Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, newNotFoundError(err)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
 
-	cmKey := client.ObjectKeyFromObject(cm)
-	err := s.Manager.Client().Get(ctx, cmKey, cm)
+// getInventory reads the stored inventory like GetInventory, and returns the apply options
+// that carry its attachments and expiry over when the inventory is written back.
+func (s *Storage) getInventory(ctx context.Context, i *Inventory) (ApplyOptions, error) {
+	obj, err := s.getStorageObject(ctx, i)
 	if err != nil {
-		return err
+		return ApplyOptions{}, err
+	}
+
+	data, err := s.readData(ctx, obj)
+	if err != nil {
+		return ApplyOptions{}, err
+	}
+
+	if err := s.decodeInventory(i, obj, data); err != nil {
+		return ApplyOptions{}, err
 	}
+	return ApplyOptions{Attachments: s.attachments(obj), expiresAt: i.ExpiresAt}, nil
+}
+
+// attachments returns the data keys of the given storage object that aren't inventory data.
+func (s *Storage) attachments(obj client.Object) map[string]string {
+	var attachments map[string]string
+	for k, v := range getStorageData(obj) {
+		if s.validateAttachmentKey(k) != nil {
+			continue
+		}
+		if attachments == nil {
+			attachments = make(map[string]string)
+		}
+		attachments[k] = v
+	}
+	return attachments
+}
 
-	s.metaFromAnnotations(i, cm.GetAnnotations())
+// decodeInventory populates the inventory from the given storage object and its data.
+func (s *Storage) decodeInventory(i *Inventory, obj client.Object, data map[string]string) error {
+	s.metaFromAnnotations(i, obj.GetAnnotations())
 
-	if _, ok := cm.Data["resources"]; !ok {
-		return fmt.Errorf("inventory data not found in ConfigMap/%s", cmKey)
+	var corrupt error
+	entries, found, err := s.decodeResources(data, s.isEncrypted(obj))
+	if !found {
+		return newNotFoundError(fmt.Errorf("inventory data '%s' not found in %s/%s", s.dataKey(), s.backendKind(), client.ObjectKeyFromObject(obj)))
 	}
-	var entries []Resource
-	err = json.Unmarshal([]byte(cm.Data["resources"]), &entries)
 	if err != nil {
-		return err
+		if !s.LenientDecoding || !errors.Is(err, ErrCorruptInventory) {
+			return err
+		}
+		corrupt = err
+		entries = []Resource{}
 	}
 	i.Resources = entries
+	i.ResourceVersion = obj.GetResourceVersion()
+	if _, ok := obj.GetAnnotations()[s.Owner.Group+"/entries"]; !ok {
+		i.Count = len(entries)
+	}
 
-	if artifacts, ok := cm.Data["artifacts"]; ok {
+	if artifacts, ok := data[artifactsKey]; ok {
 		var list []string
-		err = json.Unmarshal([]byte(artifacts), &list)
+		err = s.codec().Unmarshal([]byte(artifacts), &list)
 		if err != nil {
-			return err
+			if !s.LenientDecoding {
+				return newCorruptError(err)
+			}
+			if corrupt == nil {
+				corrupt = newCorruptError(err)
+			}
 		}
 		i.Artifacts = list
 	}
 
-	return nil
+	return corrupt
 }
 
-// ListInventories returns the inventories in the given namespace.
-func (s *Storage) ListInventories(ctx context.Context, namespace string) ([]*Inventory, error) {
-	var inventories []*Inventory
-	cmList := &corev1.ConfigMapList{}
-	err := s.Manager.Client().List(ctx, cmList, client.InNamespace(namespace), s.getOwnerLabels())
+// client returns the client used for the inventory storage objects.
+func (s *Storage) client() client.Client {
+	return s.withTimeout(s.storageClient())
+}
+
+// storageClient returns the configured storage client or the Manager client.
+func (s *Storage) storageClient() client.Client {
+	if s.StorageClient != nil {
+		return s.StorageClient
+	}
+	return s.Manager.Client()
+}
+
+// isNamespaced uses the REST mapper to determine if the given kind is namespaced.
+func (s *Storage) isNamespaced(gk schema.GroupKind) (bool, error) {
+	mapping, err := s.Manager.Client().RESTMapper().RESTMapping(gk)
 	if err != nil {
-		return inventories, err
+		return false, err
 	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
 
-	for _, cm := range cmList.Items {
-		i := NewInventory(strings.TrimPrefix(cm.GetName(), storagePrefix), cm.GetNamespace())
-		if err := s.GetInventory(ctx, i); err != nil {
-			return inventories, err
-		}
-		inventories = append(inventories, i)
+func (s *Storage) record(action string, i *Inventory) {
+	if s.Recorder != nil {
+		s.Recorder.Record(action, i.Name, i.Namespace, len(i.Resources))
 	}
+}
 
-	return inventories, nil
+// validateOwner checks that the owner group can be used as an annotation prefix.
+func validateOwner(owner ssa.Owner) error {
+	if errs := validation.IsDNS1123Subdomain(owner.Group); len(errs) > 0 {
+		return fmt.Errorf("invalid owner group '%s', the annotation prefix must be a DNS subdomain: %s",
+			owner.Group, strings.Join(errs, ", "))
+	}
+	return nil
 }
 
-// DeleteInventory removes the storage for the given inventory name and namespace.
-func (s *Storage) DeleteInventory(ctx context.Context, i *Inventory) error {
-	cm := s.newConfigMap(i.Name, i.Namespace)
+// now returns the current time according to the storage clock.
+func (s *Storage) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
 
-	cmKey := client.ObjectKeyFromObject(cm)
-	err := s.Manager.Client().Delete(ctx, cm)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to delete ConfigMap/%s, error: %w", cmKey, err)
+// createdBy returns the value of the created-by label.
+func (s *Storage) createdBy() string {
+	if s.CreatedBy != "" {
+		return s.CreatedBy
 	}
-	return nil
+	return s.Owner.Field
 }
 
-// GetInventoryStaleObjects returns the list of objects metadata subject to pruning.
-func (s *Storage) GetInventoryStaleObjects(ctx context.Context, i *Inventory) ([]*unstructured.Unstructured, error) {
-	objects := make([]*unstructured.Unstructured, 0)
-	existingInventory := NewInventory(i.Name, i.Namespace)
-	if err := s.GetInventory(ctx, existingInventory); err != nil {
-		if apierrors.IsNotFound(err) {
-			return objects, nil
-		}
-		return nil, err
+// nameLabel returns the label key holding the inventory name.
+func (s *Storage) nameLabel() string {
+	if s.Labels != nil {
+		return s.Owner.Group + "/inventory"
 	}
+	return nameLabelKey
+}
 
-	objects, err := existingInventory.Diff(i)
-	if err != nil {
-		return nil, err
+// componentLabel returns the label key holding the kind of storage object.
+func (s *Storage) componentLabel() string {
+	if s.Labels != nil {
+		return s.Owner.Group + "/component"
 	}
+	return componentLabelKey
+}
 
-	return objects, nil
+// createdByLabel returns the label key holding the creator of the storage object.
+func (s *Storage) createdByLabel() string {
+	if s.Labels != nil {
+		return s.Owner.Group + "/created-by"
+	}
+	return createdByLabelKey
 }
 
 func (s *Storage) getOwnerLabels() client.MatchingLabels {
 	return client.MatchingLabels{
-		componentLabelKey: KindName,
-		createdByLabelKey: s.Owner.Field,
+		s.componentLabel(): KindName,
+		s.createdByLabel(): s.createdBy(),
 	}
 }
 
 func (s *Storage) metaToAnnotations(inv *Inventory) map[string]string {
 	annotations := map[string]string{
-		s.Owner.Group + "/last-applied-time": time.Now().UTC().Format(time.RFC3339),
+		s.Owner.Group + "/last-applied-time": s.now().UTC().Format(time.RFC3339),
 	}
 	if inv.Source != "" {
 		annotations[s.Owner.Group+"/source"] = inv.Source
@@ -182,6 +1314,26 @@ func (s *Storage) metaToAnnotations(inv *Inventory) map[string]string {
 	if inv.Revision != "" {
 		annotations[s.Owner.Group+"/revision"] = inv.Revision
 	}
+	if s.Version != "" {
+		annotations[s.Owner.Group+"/version"] = s.Version
+	}
+	annotations[s.Owner.Group+"/checksum"] = inv.Checksum()
+	annotations[s.Owner.Group+"/entries"] = strconv.Itoa(len(inv.Resources))
+	for k, v := range inv.Metadata {
+		if strings.HasPrefix(k, s.Owner.Group+"/") {
+			if !s.isManagedAnnotation(k) {
+				annotations[k] = v
+			}
+			continue
+		}
+		annotations[s.metadataPrefix()+k] = v
+	}
+
+	for k, v := range s.ExtraAnnotations {
+		if _, ok := annotations[k]; !ok {
+			annotations[k] = v
+		}
+	}
 
 	return annotations
 }
@@ -193,10 +1345,205 @@ func (s *Storage) metaFromAnnotations(inv *Inventory, annotations map[string]str
 			inv.Source = v
 		case s.Owner.Group + "/revision":
 			inv.Revision = v
+		case s.Owner.Group + "/version":
+			inv.AppliedByVersion = v
 		case s.Owner.Group + "/last-applied-time":
 			inv.LastAppliedAt = v
+		case s.expiryAnnotation():
+			inv.ExpiresAt = v
+		case s.inactiveAnnotation():
+			inv.Inactive = v == "true"
+		case s.inactiveSinceAnnotation():
+			inv.InactiveSince = v
+		case s.Owner.Group + "/checksum":
+			inv.LastAppliedChecksum = v
+		case s.Owner.Group + "/entries":
+			if count, err := strconv.Atoi(v); err == nil {
+				inv.Count = count
+			}
+		default:
+			if !strings.HasPrefix(k, s.Owner.Group+"/") || s.isManagedAnnotation(k) {
+				continue
+			}
+			if inv.Metadata == nil {
+				inv.Metadata = make(map[string]string)
+			}
+			// metadata annotations are stored without their prefix, other unknown annotations
+			// of the owner group under their full key, so that ApplyInventory writes them back
+			inv.Metadata[strings.TrimPrefix(k, s.metadataPrefix())] = v
+		}
+	}
+}
+
+// isManagedAnnotation returns true if the given annotation is set by the storage itself.
+func (s *Storage) isManagedAnnotation(key string) bool {
+	switch key {
+	case s.Owner.Group + "/source",
+		s.Owner.Group + "/revision",
+		s.Owner.Group + "/version",
+		s.Owner.Group + "/last-applied-time",
+		s.Owner.Group + "/checksum",
+		s.Owner.Group + "/entries",
+		s.expiryAnnotation(),
+		s.inactiveAnnotation(),
+		s.inactiveSinceAnnotation(),
+		s.shardsAnnotation(),
+		s.shardsIDAnnotation(),
+		s.encryptedAnnotation(),
+		s.signatureAnnotation(),
+		s.historySequenceAnnotation():
+		return true
+	}
+	if s.Labels != nil {
+		_, ok := s.storageKeys("", "")[key]
+		return ok || key == s.shardIndexLabel() || key == s.shardIDLabel()
+	}
+	return false
+}
+
+// metadataPrefix returns the annotation prefix of the inventory metadata.
+func (s *Storage) metadataPrefix() string {
+	return s.Owner.Group + "/meta."
+}
+
+// isEncrypted returns true if the given storage object is flagged as holding an encrypted payload.
+func (s *Storage) isEncrypted(obj client.Object) bool {
+	return obj.GetAnnotations()[s.encryptedAnnotation()] == "true"
+}
+
+// storageKeys returns the keys identifying the storage object of the given inventory.
+func (s *Storage) storageKeys(name, namespace string) map[string]string {
+	return map[string]string{
+		s.nameLabel():               name,
+		s.inventoryNamespaceLabel(): namespace,
+		s.componentLabel():          KindName,
+		s.createdByLabel():          s.createdBy(),
+	}
+}
+
+// storageLabels returns the labels of the inventory storage object, the extra labels are merged
+// without overriding the kustomizer labels. When Labels is set, only those labels are returned.
+func (s *Storage) storageLabels(name, namespace string) map[string]string {
+	if s.Labels != nil {
+		labels := make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		return labels
+	}
+
+	labels := s.storageKeys(name, namespace)
+	_, _, mapped := s.nameMapper().StorageObject(name, namespace)
+	for _, extra := range []map[string]string{mapped, s.ExtraLabels} {
+		for k, v := range extra {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+	}
+	return labels
+}
+
+// storageAnnotations returns the annotations of a new storage object,
+// which hold the keys identifying the object when Labels is set.
+func (s *Storage) storageAnnotations(name, namespace string) map[string]string {
+	if s.Labels == nil {
+		return nil
+	}
+	return s.storageKeys(name, namespace)
+}
+
+// objectKeys returns the keys identifying the given storage object,
+// held by its labels, or by its annotations when Labels is set.
+func (s *Storage) objectKeys(obj metav1.Object) map[string]string {
+	if s.Labels != nil {
+		return obj.GetAnnotations()
+	}
+	return obj.GetLabels()
+}
+
+// setObjectKeys adds the given keys identifying the storage object to its labels or annotations.
+func (s *Storage) setObjectKeys(obj metav1.Object, keys map[string]string) {
+	current := s.objectKeys(obj)
+	merged := make(map[string]string, len(current)+len(keys))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range keys {
+		merged[k] = v
+	}
+	if s.Labels != nil {
+		obj.SetAnnotations(merged)
+		return
+	}
+	obj.SetLabels(merged)
+}
+
+// listSelector returns the labels selecting the storage objects with the given keys,
+// or the Labels when set, in which case the objects must be filtered with hasKeys.
+func (s *Storage) listSelector(keys client.MatchingLabels) client.MatchingLabels {
+	if s.Labels != nil {
+		return client.MatchingLabels(s.Labels)
+	}
+	return keys
+}
+
+// hasKeys returns true if the given storage object is identified by all the given keys.
+func (s *Storage) hasKeys(obj metav1.Object, keys client.MatchingLabels) bool {
+	objKeys := s.objectKeys(obj)
+	for k, v := range keys {
+		if current, ok := objKeys[k]; !ok || current != v {
+			return false
 		}
 	}
+	return true
+}
+
+// storageNamespace returns the namespace of the storage object for the given inventory.
+func (s *Storage) storageNamespace(name, namespace string) string {
+	_, objNamespace, _ := s.nameMapper().StorageObject(name, namespace)
+	return objNamespace
+}
+
+// storageName returns the name of the storage object for the given inventory.
+func (s *Storage) storageName(name, namespace string) string {
+	objName, _, _ := s.nameMapper().StorageObject(name, namespace)
+	return objName
+}
+
+// inventoryName returns the name of the inventory stored in the given object.
+// For objects without the name label, the prefix and suffix of the default mapper are trimmed.
+func (s *Storage) inventoryName(obj metav1.Object) string {
+	if name, ok := s.objectKeys(obj)[s.nameLabel()]; ok {
+		return name
+	}
+	m, ok := s.nameMapper().(DefaultNameMapper)
+	if !ok {
+		return obj.GetName()
+	}
+	prefix := storagePrefix
+	if m.Prefix != "" {
+		prefix = m.Prefix
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(obj.GetName(), prefix), m.Suffix)
+}
+
+// inventoryNamespace returns the namespace of the inventory stored in the given object,
+// which differs from the object namespace when the name mapper moves it.
+func (s *Storage) inventoryNamespace(obj metav1.Object) string {
+	if namespace, ok := s.objectKeys(obj)[s.inventoryNamespaceLabel()]; ok {
+		return namespace
+	}
+	return obj.GetNamespace()
+}
+
+// listNamespace returns the namespace of the storage objects listed for the inventories
+// in the given namespace, empty for all namespaces.
+func (s *Storage) listNamespace(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return s.storageNamespace("", namespace)
 }
 
 func (s *Storage) newConfigMap(name, namespace string) *corev1.ConfigMap {
@@ -206,19 +1553,160 @@ func (s *Storage) newConfigMap(name, namespace string) *corev1.ConfigMap {
 			Kind:       "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      storagePrefix + name,
-			Namespace: namespace,
-			Labels: map[string]string{
-				nameLabelKey:      name,
-				componentLabelKey: KindName,
-				createdByLabelKey: s.Owner.Field,
-			},
+			Name:        s.storageName(name, namespace),
+			Namespace:   s.storageNamespace(name, namespace),
+			Labels:      s.storageLabels(name, namespace),
+			Annotations: s.storageAnnotations(name, namespace),
+		},
+	}
+}
+
+func (s *Storage) newSecret(name, namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.storageName(name, namespace),
+			Namespace:   s.storageNamespace(name, namespace),
+			Labels:      s.storageLabels(name, namespace),
+			Annotations: s.storageAnnotations(name, namespace),
 		},
+		Type: corev1.SecretTypeOpaque,
+	}
+}
+
+// newStorageObject returns the ConfigMap or Secret used to store the inventory based on the configured backend.
+func (s *Storage) newStorageObject(name, namespace string) client.Object {
+	var obj client.Object = s.newConfigMap(name, namespace)
+	if s.Backend == SecretBackend {
+		obj = s.newSecret(name, namespace)
+	}
+	if s.OwnerReference != nil {
+		obj.SetOwnerReferences([]metav1.OwnerReference{*s.OwnerReference})
+	}
+	return obj
+}
+
+// emptyStorageObject returns an empty ConfigMap or Secret to read a storage object into,
+// as decoding into a populated object keeps the map keys missing from the stored object.
+func (s *Storage) emptyStorageObject() client.Object {
+	if s.Backend == SecretBackend {
+		return &corev1.Secret{}
+	}
+	return &corev1.ConfigMap{}
+}
+
+// listStorageObjects returns the ConfigMaps or Secrets matching the given labels in the given namespace.
+func (s *Storage) listStorageObjects(ctx context.Context, namespace string, labels client.MatchingLabels) ([]client.Object, error) {
+	if err := s.validateLabels(); err != nil {
+		return nil, err
+	}
+	var objects []client.Object
+	opts := []client.ListOption{client.InNamespace(namespace), s.listSelector(labels)}
+
+	if s.Backend == SecretBackend {
+		list := &corev1.SecretList{}
+		if err := s.client().List(ctx, list, opts...); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			if s.hasKeys(&list.Items[i], labels) {
+				objects = append(objects, &list.Items[i])
+			}
+		}
+		return objects, nil
+	}
+
+	list := &corev1.ConfigMapList{}
+	if err := s.client().List(ctx, list, opts...); err != nil {
+		return nil, err
 	}
+	for i := range list.Items {
+		if s.hasKeys(&list.Items[i], labels) {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+	return objects, nil
+}
+
+func (s *Storage) backendKind() string {
+	if s.Backend == SecretBackend {
+		return string(SecretBackend)
+	}
+	return string(ConfigMapBackend)
+}
+
+// getStorageData returns the string data of the given ConfigMap or Secret.
+func getStorageData(obj client.Object) map[string]string {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		return o.Data
+	case *corev1.Secret:
+		data := make(map[string]string, len(o.Data))
+		for k, v := range o.Data {
+			data[k] = string(v)
+		}
+		return data
+	}
+	return nil
+}
+
+// setStorageData sets the data of the given ConfigMap or Secret.
+func setStorageData(obj client.Object, data map[string]string) {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		o.Data = data
+	case *corev1.Secret:
+		o.Data = make(map[string][]byte, len(data))
+		for k, v := range data {
+			o.Data[k] = []byte(v)
+		}
+	}
+}
+
+// setStorageImmutable marks the given ConfigMap or Secret as immutable.
+func setStorageImmutable(obj client.Object) {
+	immutable := true
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		o.Immutable = &immutable
+	case *corev1.Secret:
+		o.Immutable = &immutable
+	}
+}
+
+// isStorageImmutable returns true if the given ConfigMap or Secret is immutable.
+func isStorageImmutable(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		return o.Immutable != nil && *o.Immutable
+	case *corev1.Secret:
+		return o.Immutable != nil && *o.Immutable
+	}
+	return false
+}
+
+func equalStorageData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
 }
 
-// createNamespace creates the inventory namespace if not present.
-func (s *Storage) createNamespace(ctx context.Context, name string) error {
+// createNamespace creates the inventory namespace if not present, and returns true if it was created.
+// It's a no-op for inventories without a namespace.
+func (s *Storage) createNamespace(ctx context.Context, name string, opts []client.PatchOption) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
 	ns := &corev1.Namespace{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
@@ -227,22 +1715,32 @@ func (s *Storage) createNamespace(ctx context.Context, name string) error {
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
 			Labels: map[string]string{
-				createdByLabelKey: s.Owner.Field,
+				s.createdByLabel(): s.createdBy(),
 			},
 		},
 	}
+	if s.Labels != nil {
+		ns.SetLabels(s.storageLabels(name, ""))
+	}
+	return applyNamespace(ctx, s.client(), ns, opts)
+}
 
-	if err := s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(ns), ns); err != nil {
+// applyNamespace creates the given namespace if not present, and returns true if it was created.
+// An existing namespace isn't patched, so that its fields aren't taken over.
+func applyNamespace(ctx context.Context, c client.Client, ns *corev1.Namespace, opts []client.PatchOption) (bool, error) {
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ns), ns); err != nil {
 		if apierrors.IsNotFound(err) {
-			opts := []client.PatchOption{
-				client.ForceOwnership,
-				client.FieldOwner(s.Owner.Field),
+			if err := c.Patch(ctx, ns, client.Apply, opts...); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					return false, nil
+				}
+				return false, err
 			}
-			return s.Manager.Client().Patch(ctx, ns, client.Apply, opts...)
+			return true, nil
 		} else {
-			return err
+			return false, err
 		}
 	}
 
-	return nil
+	return false, nil
 }
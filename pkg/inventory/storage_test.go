@@ -0,0 +1,1388 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	. "github.com/onsi/gomega"
+)
+
+var testOwner = ssa.Owner{
+	Field: "kustomizer",
+	Group: "inventory.kustomizer.dev",
+}
+
+func newTestStorage(objects ...client.Object) *Storage {
+	scheme := apiruntime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &Storage{
+		Manager: ssa.NewResourceManager(&applyClient{kubeClient}, nil, testOwner),
+		Owner:   testOwner,
+	}
+}
+
+// applyClient emulates server-side apply on top of the fake client,
+// which doesn't support apply patches, by creating or replacing the object
+// and recording the field manager in the managed fields. The field ownership semantics
+// of server-side apply are tested against envtest in cmd/kustomizer.
+type applyClient struct {
+	client.Client
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if len(patchOpts.DryRun) > 0 {
+		return nil
+	}
+
+	fields, err := appliedFields(obj)
+	if err != nil {
+		return err
+	}
+	managedFields := []metav1.ManagedFieldsEntry{{
+		Manager:   patchOpts.FieldManager,
+		Operation: metav1.ManagedFieldsOperationApply,
+		FieldsV1:  fields,
+	}}
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			obj.SetManagedFields(managedFields)
+			return c.Client.Create(ctx, obj)
+		}
+		return err
+	}
+
+	// a field manager that doesn't manage the object yet only sets the fields it applies
+	if len(existing.GetManagedFields()) > 0 && !hasManager(existing, patchOpts.FieldManager) {
+		if err := mergeApplied(existing, obj); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range existing.GetManagedFields() {
+		if entry.Manager != patchOpts.FieldManager {
+			managedFields = append(managedFields, entry)
+		}
+	}
+	obj.SetManagedFields(managedFields)
+
+	if obj.GetResourceVersion() == "" {
+		obj.SetResourceVersion(existing.GetResourceVersion())
+	}
+	return c.Client.Update(ctx, obj)
+}
+
+// appliedFields returns the managed fields set of the given applied object,
+// the lists are recorded as atomic.
+func appliedFields(obj client.Object) (*metav1.FieldsV1, error) {
+	u, err := apiruntime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	content := make(map[string]interface{}, len(u))
+	for k, v := range u {
+		content[k] = v
+	}
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		applied := map[string]interface{}{}
+		for _, k := range []string{"labels", "annotations"} {
+			if v, ok := metadata[k]; ok && v != nil {
+				applied[k] = v
+			}
+		}
+		delete(content, "metadata")
+		if len(applied) > 0 {
+			content["metadata"] = applied
+		}
+	}
+
+	var set func(value interface{}) map[string]interface{}
+	set = func(value interface{}) map[string]interface{} {
+		result := map[string]interface{}{}
+		if fields, ok := value.(map[string]interface{}); ok {
+			for k, v := range fields {
+				if v != nil {
+					result["f:"+k] = set(v)
+				}
+			}
+		}
+		return result
+	}
+	raw, err := json.Marshal(set(content))
+	if err != nil {
+		return nil, err
+	}
+	return &metav1.FieldsV1{Raw: raw}, nil
+}
+
+func hasManager(obj client.Object, manager string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == manager {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeApplied sets on obj the fields of the existing object overlaid with the fields set in obj.
+func mergeApplied(existing, obj client.Object) error {
+	base, err := apiruntime.DefaultUnstructuredConverter.ToUnstructured(existing)
+	if err != nil {
+		return err
+	}
+	applied, err := apiruntime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	mergeFields(base, applied)
+	return apiruntime.DefaultUnstructuredConverter.FromUnstructured(base, obj)
+}
+
+func mergeFields(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				mergeFields(d, m)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+func TestGetInventory_NotFound(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+
+	t.Run("missing storage object", func(t *testing.T) {
+		err := s.GetInventory(context.Background(), NewInventory("test", "default"))
+		g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("missing inventory data", func(t *testing.T) {
+		cm := s.newConfigMap("empty", "default")
+		g.Expect(s.Manager.Client().Create(context.Background(), cm)).To(Succeed())
+
+		err := s.GetInventory(context.Background(), NewInventory("empty", "default"))
+		g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+	})
+}
+
+func TestListInventories(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	for _, ns := range []string{"default", "other"} {
+		cm := s.newConfigMap("test", ns)
+		cm.Annotations = map[string]string{testOwner.Group + "/revision": "v1.0.0"}
+		cm.Data = map[string]string{resourcesKey: `[{"id":"default_test__ConfigMap","ver":"v1"}]`}
+		g.Expect(s.Manager.Client().Create(ctx, cm)).To(Succeed())
+	}
+
+	t.Run("lists inventories with entries", func(t *testing.T) {
+		inventories, err := s.ListInventories(ctx, "default")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(inventories).To(HaveLen(1))
+		g.Expect(inventories[0].Name).To(Equal("test"))
+		g.Expect(inventories[0].Revision).To(Equal("v1.0.0"))
+		g.Expect(inventories[0].Resources).To(HaveLen(1))
+		g.Expect(inventories[0].Count).To(Equal(1))
+	})
+
+	t.Run("lists inventories metadata across namespaces", func(t *testing.T) {
+		inventories, err := s.ListInventoriesMeta(ctx, "")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(inventories).To(HaveLen(2))
+		g.Expect(inventories[0].Revision).To(Equal("v1.0.0"))
+		g.Expect(inventories[0].Resources).To(BeEmpty())
+	})
+}
+
+func TestApplyInventory_ExtraMetadata(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.ExtraLabels = map[string]string{
+		"cost-center":     "platform",
+		componentLabelKey: "override",
+	}
+	s.ExtraAnnotations = map[string]string{
+		"team": "sre",
+	}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("https://github.com/stefanprodan/kustomizer.git", "v1.0.0", nil)
+
+	for n := 0; n < 2; n++ {
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	cm := s.newConfigMap(inv.Name, inv.Namespace)
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue("cost-center", "platform"))
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue(componentLabelKey, KindName))
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue(nameLabelKey, inv.Name))
+	g.Expect(cm.GetAnnotations()).To(HaveKeyWithValue("team", "sre"))
+	g.Expect(cm.GetAnnotations()).To(HaveKeyWithValue(testOwner.Group+"/source", inv.Source))
+
+	result := NewInventory(inv.Name, inv.Namespace)
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Source).To(Equal(inv.Source))
+	g.Expect(cm.GetAnnotations()).To(HaveKeyWithValue(testOwner.Group+"/entries", "0"))
+}
+
+func TestApplyInventory_ReservedExtraAnnotations(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.ExtraAnnotations = map[string]string{
+		testOwner.Group + "/revision": "override",
+	}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	_, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).To(MatchError(ContainSubstring("is reserved")))
+	g.Expect(errors.Is(s.GetInventory(ctx, NewInventory("test", "default")), ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestDeleteInventoryAndWait(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.DeleteInventoryAndWait(ctx, inv, time.Second)).To(Succeed())
+
+	err := s.GetInventory(ctx, inv)
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestApplyInventory_Immutable(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.Immutable = true
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := s.newConfigMap(inv.Name, inv.Namespace)
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+	g.Expect(*cm.Immutable).To(BeTrue())
+	uid := cm.GetUID()
+
+	t.Run("keeps the object when data is unchanged", func(t *testing.T) {
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+		g.Expect(s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+		g.Expect(cm.GetUID()).To(Equal(uid))
+	})
+
+	t.Run("recreates the object when data changes", func(t *testing.T) {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"})
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+		result := NewInventory(inv.Name, inv.Namespace)
+		g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+		g.Expect(result.Resources).To(HaveLen(2))
+	})
+}
+
+func TestApplyInventory_Conflict(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+
+	first := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, first)).To(Succeed())
+	g.Expect(first.ResourceVersion).NotTo(BeEmpty())
+
+	second := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, second)).To(Succeed())
+
+	first.Resources = append(first.Resources, Resource{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"})
+	g.Expect(s.ApplyInventory(ctx, first, ApplyOptions{})).Error().To(Succeed())
+
+	second.Resources = append(second.Resources, Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"})
+	_, err := s.ApplyInventory(ctx, second, ApplyOptions{})
+	g.Expect(errors.Is(err, ErrInventoryConflict)).To(BeTrue())
+}
+
+func TestApplyInventory_CreateNamespace(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "new-namespace")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true})).Error().To(Succeed())
+
+	ns := &corev1.Namespace{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: inv.Namespace}, ns)).To(Succeed())
+	g.Expect(ns.GetLabels()).To(HaveKeyWithValue(createdByLabelKey, testOwner.Field))
+}
+
+// namespaceClient fails the dry run apply of namespaced objects in a missing namespace,
+// as the API server does.
+type namespaceClient struct {
+	client.Client
+}
+
+func (c *namespaceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if len(patchOpts.DryRun) > 0 && obj.GetNamespace() != "" {
+		if err := c.Client.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, &corev1.Namespace{}); err != nil {
+			return err
+		}
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyInventory_CreateNamespaceDryRun(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.StorageClient = &namespaceClient{s.Manager.Client()}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "new-namespace")
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true, DryRun: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	err = s.Manager.Client().Get(ctx, client.ObjectKey{Name: inv.Namespace}, &corev1.Namespace{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(errors.Is(s.GetInventory(ctx, NewInventory("test", "new-namespace")), ErrInventoryNotFound)).To(BeTrue())
+}
+
+type testRecorder struct {
+	events []string
+}
+
+func (r *testRecorder) Record(action, name, namespace string, count int) {
+	r.events = append(r.events, fmt.Sprintf("%s %s/%s %d", action, namespace, name, count))
+}
+
+func TestStorage_Recorder(t *testing.T) {
+	g := NewWithT(t)
+	recorder := &testRecorder{}
+	s := newTestStorage()
+	s.Recorder = recorder
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{DryRun: true})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+
+	g.Expect(recorder.events).To(Equal([]string{
+		"apply default/test 1",
+		"delete default/test 1",
+	}))
+}
+
+func TestStorage_StorageClient(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	hub := newTestStorage()
+	s.StorageClient = hub.Manager.Client()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	g.Expect(hub.GetInventory(ctx, NewInventory("test", "default"))).To(Succeed())
+	err := s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	err = hub.GetInventory(ctx, NewInventory("test", "default"))
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestApplyInventory_FieldManager(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{FieldManager: "kustomizer-staging"})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}, cm)).To(Succeed())
+
+	var managers []string
+	for _, entry := range cm.GetManagedFields() {
+		managers = append(managers, entry.Manager)
+	}
+	g.Expect(managers).To(ConsistOf("kustomizer-staging", testOwner.Field))
+}
+
+// conflictClient fails the apply patches that don't force the field ownership.
+type conflictClient struct {
+	client.Client
+	calls int
+}
+
+func (c *conflictClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if patch.Type() == types.ApplyPatchType && patchOpts.Force == nil {
+		c.calls++
+		return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(),
+			errors.New("conflict with kubectl"))
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyInventory_StrictConflicts(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	c := &conflictClient{Client: s.Manager.Client()}
+	s.StorageClient = c
+	s.Retry = RetryOptions{Attempts: 3}
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+	g.Expect(c.calls).To(BeZero())
+
+	s.StrictConflicts = true
+	_, err := s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})
+	g.Expect(err).To(MatchError(ErrInventoryConflict))
+	g.Expect(c.calls).To(Equal(1))
+}
+
+func TestApplyInventory_Metadata(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Metadata = map[string]string{
+		"author":    "dev@example.com",
+		"build-url": "https://ci.example.com/builds/1",
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Metadata).To(Equal(inv.Metadata))
+
+	inv.Metadata["notes"] = strings.Repeat("x", 256*1024)
+	_, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("annotations"))
+}
+
+func TestStorage_DefaultNamespace(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.DefaultNamespace = "kustomizer-system"
+	ctx := context.Background()
+
+	inv := NewInventory("crds", "")
+	inv.Resources = []Resource{{ObjectID: "_crontabs.stable.example.com_apiextensions.k8s.io_CustomResourceDefinition", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{CreateNamespace: true})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: s.DefaultNamespace}, cm)).To(Succeed())
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: s.DefaultNamespace}, &corev1.Namespace{})).To(Succeed())
+
+	result := NewInventory("crds", "")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	err := s.GetInventory(ctx, result)
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestGetInventory_PresetSource(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	g.Expect(s.GetInventory(ctx, inv)).To(Succeed())
+	g.Expect(inv.Source).To(Equal("oci://registry/app"))
+	g.Expect(inv.Revision).To(Equal("1.0.0"))
+}
+
+func TestApplyInventory_OwnerReference(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.OwnerReference = &metav1.OwnerReference{
+		APIVersion: "apps.example.com/v1",
+		Kind:       "Release",
+		Name:       "test",
+		UID:        "6f2b1c55-3d5e-4c8a-9b1e-2f0a4d7c9e11",
+	}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}, cm)).To(Succeed())
+	g.Expect(cm.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{*s.OwnerReference}))
+}
+
+func TestGetInventoryEntries(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	for _, compress := range []bool{false, true} {
+		s := newTestStorage()
+		s.Compress = compress
+
+		inv := NewInventory("test", "default")
+		for n := 0; n < 10; n++ {
+			inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+		}
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+		var entries []Resource
+		g.Expect(s.GetInventoryEntries(ctx, NewInventory("test", "default"), func(entry Resource) error {
+			entries = append(entries, entry)
+			return nil
+		})).To(Succeed())
+		g.Expect(entries).To(Equal(inv.Resources))
+
+		visited := 0
+		g.Expect(s.GetInventoryEntries(ctx, NewInventory("test", "default"), func(entry Resource) error {
+			visited++
+			if entry.ObjectID == "default_cm2__ConfigMap" {
+				return ErrStop
+			}
+			return nil
+		})).To(Succeed())
+		g.Expect(visited).To(Equal(3))
+	}
+}
+
+func TestGetInventoryStaleObjects_NamespaceChange(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{{ObjectID: "staging_app_apps_Deployment", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, previous, ApplyOptions{})).Error().To(Succeed())
+
+	current := NewInventory("test", "default")
+	current.Resources = []Resource{{ObjectID: "production_app_apps_Deployment", ObjectVersion: "v1"}}
+
+	stale, err := s.GetInventoryStaleObjects(ctx, current, PruneOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(1))
+	g.Expect(stale[0].GetNamespace()).To(Equal("staging"))
+	g.Expect(stale[0].GetName()).To(Equal("app"))
+}
+
+// xorEncryptor is a reversible test cipher.
+type xorEncryptor struct{}
+
+func (xorEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	out := make([]byte, len(plaintext))
+	for n, b := range plaintext {
+		out[n] = b ^ 0x5a
+	}
+	return out, nil
+}
+
+func (e xorEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	return e.Encrypt(ciphertext)
+}
+
+func TestApplyInventory_Encryptor(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	for _, compress := range []bool{false, true} {
+		s := newTestStorage()
+		s.Encryptor = xorEncryptor{}
+		s.Compress = compress
+
+		inv := NewInventory("test", "default")
+		inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}, cm)).To(Succeed())
+		g.Expect(cm.GetAnnotations()).To(HaveKeyWithValue(testOwner.Group+"/encrypted", "true"))
+		for _, value := range cm.Data {
+			g.Expect(value).ToNot(ContainSubstring("default_a__ConfigMap"))
+		}
+
+		result := NewInventory("test", "default")
+		g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+		g.Expect(result.Resources).To(Equal(inv.Resources))
+
+		s.Encryptor = nil
+		err := s.GetInventory(ctx, NewInventory("test", "default"))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("no encryptor is configured"))
+	}
+}
+
+func TestApplyInventory_CreatedBy(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.CreatedBy = "platform"
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{FieldManager: "kustomizer-prod"})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}, cm)).To(Succeed())
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue(createdByLabelKey, "platform"))
+	g.Expect(cm.GetManagedFields()).To(HaveLen(1))
+	g.Expect(cm.GetManagedFields()[0].Manager).To(Equal("kustomizer-prod"))
+
+	inventories, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inventories).To(HaveLen(1))
+}
+
+func TestApplyInventory_InvalidOwnerGroup(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.Owner.Group = "Inventory_Kustomizer"
+
+	_, err := s.ApplyInventory(context.Background(), NewInventory("test", "default"), ApplyOptions{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("invalid owner group 'Inventory_Kustomizer'"))
+}
+
+// slowClient blocks get calls until the context is done.
+type slowClient struct {
+	client.Client
+}
+
+func (c *slowClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStorage_OperationTimeout(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.StorageClient = &slowClient{Client: s.Manager.Client()}
+	s.OperationTimeout = 10 * time.Millisecond
+
+	err := s.GetInventory(context.Background(), NewInventory("test", "default"))
+	g.Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+}
+
+func TestGetInventoryStaleObjects_Exclusions(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{
+		{ObjectID: "_apps__Namespace", ObjectVersion: "v1"},
+		{ObjectID: "apps_data-db__PersistentVolumeClaim", ObjectVersion: "v1"},
+		{ObjectID: "apps_cache__PersistentVolumeClaim", ObjectVersion: "v1"},
+		{ObjectID: "apps_app_apps_Deployment", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, previous, ApplyOptions{})).Error().To(Succeed())
+
+	stale, err := s.GetInventoryStaleObjects(ctx, NewInventory("test", "default"), PruneOptions{
+		Exclusions: []Exclusion{
+			{GroupVersionKind: corev1.SchemeGroupVersion.WithKind("Namespace")},
+			{GroupVersionKind: schema.GroupVersionKind{Kind: "PersistentVolumeClaim"}, Name: "data-*"},
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var names []string
+	for _, obj := range stale {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(ConsistOf("cache", "app"))
+}
+
+func TestGetInventoryStaleObjects_Namespace(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{
+		{ObjectID: "_apps__Namespace", ObjectVersion: "v1"},
+		{ObjectID: "apps_app_apps_Deployment", ObjectVersion: "v1"},
+		{ObjectID: "web_app_apps_Deployment", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, previous, ApplyOptions{})).Error().To(Succeed())
+
+	stale, err := s.GetInventoryStaleObjects(ctx, NewInventory("test", "default"), PruneOptions{Namespace: "apps"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(1))
+	g.Expect(stale[0].GetNamespace()).To(Equal("apps"))
+	g.Expect(stale[0].GetKind()).To(Equal("Deployment"))
+
+	stale, err = s.GetInventoryStaleObjects(ctx, NewInventory("test", "default"), PruneOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(3))
+}
+
+func TestGetInventoryStaleObjects_Progress(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	previous := NewInventory("test", "default")
+	previous.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_c__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, previous, ApplyOptions{})).Error().To(Succeed())
+
+	current := NewInventory("test", "default")
+	current.Resources = previous.Resources[:1]
+	var progress [][2]int
+	stale, err := s.GetInventoryStaleObjects(ctx, current, PruneOptions{
+		Progress: func(current, total int) {
+			progress = append(progress, [2]int{current, total})
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stale).To(HaveLen(2))
+	g.Expect(progress).To(Equal([][2]int{{1, 3}, {2, 3}, {3, 3}}))
+}
+
+func TestStorage_Touch(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Name: storagePrefix + inv.Name, Namespace: inv.Namespace}
+	g.Expect(s.Manager.Client().Get(ctx, key, cm)).To(Succeed())
+	cm.Annotations[testOwner.Group+"/last-applied-time"] = "2021-01-01T00:00:00Z"
+	g.Expect(s.Manager.Client().Update(ctx, cm)).To(Succeed())
+
+	g.Expect(s.Touch(ctx, inv)).To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.LastAppliedAt).ToNot(Equal("2021-01-01T00:00:00Z"))
+	g.Expect(result.LastAppliedAt).To(Equal(inv.LastAppliedAt))
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+	g.Expect(result.LastAppliedChecksum).To(Equal(inv.Checksum()))
+
+	g.Expect(s.Manager.Client().Get(ctx, key, cm)).To(Succeed())
+	var managers []string
+	for _, entry := range cm.GetManagedFields() {
+		g.Expect(entry.Operation).To(Equal(metav1.ManagedFieldsOperationApply))
+		managers = append(managers, entry.Manager)
+	}
+	g.Expect(managers).To(ConsistOf(testOwner.Field, testOwner.Field+"-touch"))
+
+	err := s.Touch(ctx, NewInventory("missing", "default"))
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+func TestStorage_TouchStrictConflicts(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.StrictConflicts = true
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.Touch(ctx, inv)).To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	g.Expect(s.Touch(ctx, inv)).To(Succeed())
+	stale := inv.DeepCopy()
+	g.Expect(s.Touch(ctx, inv)).To(Succeed())
+	_, err := s.ApplyInventory(ctx, stale, ApplyOptions{})
+	g.Expect(errors.Is(err, ErrInventoryConflict)).To(BeTrue())
+}
+
+func TestApplyInventory_Changed(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeFalse())
+
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	inv.Resources = append(inv.Resources, Resource{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"})
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+}
+
+func TestApplyInventory_ChangedExpiry(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{TTL: time.Hour})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	now = now.Add(time.Minute)
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{TTL: time.Hour})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeFalse())
+
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+}
+
+// decodingClient decodes the objects into the given target without resetting it first,
+// as the JSON decoding of a real client does.
+type decodingClient struct {
+	client.Client
+}
+
+func (c *decodingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	fresh := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if err := c.Client.Get(ctx, key, fresh, opts...); err != nil {
+		return err
+	}
+	data, err := json.Marshal(fresh)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+func TestApplyInventory_ChangedAddedKeys(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.StorageClient = &decodingClient{s.Manager.Client()}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	s.ExtraAnnotations = map[string]string{"team": "platform"}
+	result, err := s.ApplyInventory(ctx, inv, ApplyOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+
+	result, err = s.ApplyInventory(ctx, inv, ApplyOptions{Attachments: map[string]string{"report": "ok"}})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Changed).To(BeTrue())
+}
+
+func TestStorage_NameAffixes(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.NamePrefix = "team-"
+	s.NameSuffix = "-v2"
+	ctx := context.Background()
+
+	inv := NewInventory("app", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKey{Name: "team-app-v2", Namespace: "default"}, cm)).To(Succeed())
+	g.Expect(cm.GetLabels()).To(HaveKeyWithValue(nameLabelKey, "app"))
+
+	result := NewInventory("app", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	inventories, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inventories).To(HaveLen(1))
+	g.Expect(inventories[0].Name).To(Equal("app"))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	err = s.GetInventory(ctx, result)
+	g.Expect(errors.Is(err, ErrInventoryNotFound)).To(BeTrue())
+}
+
+// forbiddenDeleteClient rejects the deletion of the object with the given name.
+type forbiddenDeleteClient struct {
+	client.Client
+	name string
+}
+
+func (c *forbiddenDeleteClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if obj.GetName() == c.name {
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, c.name, nil)
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestDeleteInventories(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	var inventories []*Inventory
+	for _, name := range []string{"a", "b", "c"} {
+		inv := NewInventory(name, "default")
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+		inventories = append(inventories, inv)
+	}
+	inventories = append(inventories, NewInventory("missing", "default"))
+
+	s.StorageClient = &forbiddenDeleteClient{Client: s.Manager.Client(), name: storagePrefix + "b"}
+	err := s.DeleteInventories(ctx, inventories)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(storagePrefix + "b"))
+
+	remaining, err := s.ListInventories(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(remaining).To(HaveLen(1))
+	g.Expect(remaining[0].Name).To(Equal("b"))
+}
+
+func TestInventoryFromConfigMap(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", []string{"oci://registry/app:1.0.0"})
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	result, err := s.InventoryFromConfigMap(cm)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Name).To(Equal("test"))
+	g.Expect(result.Namespace).To(Equal("default"))
+	g.Expect(result.Source).To(Equal(inv.Source))
+	g.Expect(result.Revision).To(Equal(inv.Revision))
+	g.Expect(result.LastAppliedAt).ToNot(BeEmpty())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+	g.Expect(result.Artifacts).To(Equal(inv.Artifacts))
+}
+
+func TestApplyInventory_UnknownAnnotations(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	custom := testOwner.Group + "/custom"
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	cm.Annotations[custom] = "value"
+	g.Expect(s.Manager.Client().Update(ctx, cm)).To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Metadata).To(Equal(map[string]string{custom: "value"}))
+
+	g.Expect(s.ApplyInventory(ctx, result, ApplyOptions{})).Error().To(Succeed())
+	cm, err = s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cm.Annotations).To(HaveKeyWithValue(custom, "value"))
+}
+
+func TestStorage_Now(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	now := time.Date(2021, 11, 5, 10, 30, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.LastAppliedAt).To(Equal("2021-11-05T10:30:00Z"))
+
+	now = now.Add(time.Hour)
+	g.Expect(s.Touch(ctx, result)).To(Succeed())
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.LastAppliedTime()).To(Equal(now))
+}
+
+func TestApplyInventory_ClearSource(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm, err := s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(s.clearedAnnotations(NewInventory("test", "default"), cm)).To(Equal([]string{
+		testOwner.Group + "/revision",
+		testOwner.Group + "/source",
+	}))
+
+	inv.SetSource("", "", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm, err = s.GetInventoryConfigMap(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cm.Annotations).ToNot(HaveKey(testOwner.Group + "/source"))
+	g.Expect(cm.Annotations).ToNot(HaveKey(testOwner.Group + "/revision"))
+	g.Expect(inv.ResourceVersion).To(Equal(cm.ResourceVersion))
+}
+
+func TestApplyInventory_Version(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.AppliedByVersion).To(BeEmpty())
+
+	s.Version = "2.1.0"
+	g.Expect(s.ApplyInventory(ctx, NewInventory("test", "default"), ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.AppliedByVersion).To(Equal("2.1.0"))
+	g.Expect(result.Metadata).To(BeEmpty())
+}
+
+func TestStorage_Concurrent(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.Compress = true
+	ctx := context.Background()
+
+	errs := make(chan error, 20)
+	for n := 0; n < cap(errs); n++ {
+		go func(n int) {
+			// the fake client emulation of server-side apply isn't atomic,
+			// hence each goroutine writes its own inventory
+			inv := NewInventory(fmt.Sprintf("test-%d", n), "default")
+			inv.Resources = []Resource{{ObjectID: fmt.Sprintf("default_cm-%d__ConfigMap", n), ObjectVersion: "v1"}}
+			if _, err := s.ApplyInventory(ctx, inv, ApplyOptions{}); err != nil {
+				errs <- err
+				return
+			}
+			errs <- s.GetInventory(ctx, NewInventory(inv.Name, inv.Namespace))
+		}(n)
+	}
+	for n := 0; n < cap(errs); n++ {
+		g.Expect(<-errs).To(Succeed())
+	}
+}
+
+func TestGetInventoryMeta(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "1.0.0", nil)
+	inv.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventoryMeta(ctx, result)).To(Succeed())
+	g.Expect(result.Source).To(Equal(inv.Source))
+	g.Expect(result.Revision).To(Equal(inv.Revision))
+	g.Expect(result.Count).To(Equal(2))
+	g.Expect(result.LastAppliedAt).ToNot(BeEmpty())
+	g.Expect(result.ResourceVersion).ToNot(BeEmpty())
+	g.Expect(result.Resources).To(BeEmpty())
+
+	g.Expect(s.GetInventoryMeta(ctx, NewInventory("missing", "default"))).To(MatchError(ErrInventoryNotFound))
+}
+
+func TestApplyInventory_VerifyOwnership(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: storagePrefix + "other", Namespace: "default"},
+	})
+	s.VerifyOwnership = true
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	_, err := s.ApplyInventory(ctx, NewInventory("other", "default"), ApplyOptions{})
+	g.Expect(err).To(MatchError(ErrOwnershipConflict))
+
+	s.VerifyOwnership = false
+	g.Expect(s.ApplyInventory(ctx, NewInventory("other", "default"), ApplyOptions{})).Error().To(Succeed())
+}
+
+func TestApplyInventory_Attachments(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{
+		Attachments: map[string]string{"diff.txt": "+ ConfigMap/default/a"},
+	})).Error().To(Succeed())
+
+	value, err := s.GetAttachment(ctx, inv, "diff.txt")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value).To(Equal("+ ConfigMap/default/a"))
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+
+	_, err = s.GetAttachment(ctx, inv, "provenance.json")
+	g.Expect(err).To(MatchError(ErrInventoryNotFound))
+
+	for _, key := range []string{resourcesKey, artifactsKey, "invalid/key"} {
+		_, err = s.ApplyInventory(ctx, inv, ApplyOptions{Attachments: map[string]string{key: "value"}})
+		g.Expect(err).To(HaveOccurred())
+	}
+}
+
+func TestGetInventoryRaw(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	s.Compress = true
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	raw, err := s.GetInventoryRaw(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(raw)).To(Equal(`{"version":1,"entries":[{"id":"default_a__ConfigMap","ver":"v1"}]}`))
+
+	_, err = s.GetInventoryRaw(ctx, NewInventory("missing", "default"))
+	g.Expect(err).To(MatchError(ErrInventoryNotFound))
+}
+
+func TestDeleteInventoryAndObjects(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+	)
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__Secret", ObjectVersion: "v1"},
+		{ObjectID: "default_missing__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	deleted, err := s.DeleteInventoryAndObjects(ctx, NewInventory("test", "default"))
+	g.Expect(err).ToNot(HaveOccurred())
+	var names []string
+	for _, obj := range deleted {
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{"Secret/b", "ConfigMap/a"}))
+
+	err = s.Manager.Client().Get(ctx, client.ObjectKey{Name: "a", Namespace: "default"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(s.GetInventory(ctx, NewInventory("test", "default"))).To(MatchError(ErrInventoryNotFound))
+
+	deleted, err = s.DeleteInventoryAndObjects(ctx, NewInventory("test", "default"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(deleted).To(BeEmpty())
+}
+
+func TestGetInventory_LenientDecoding(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "v1", nil)
+	inv.Resources = []Resource{{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"}}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(s.Manager.Client().Get(ctx, client.ObjectKeyFromObject(s.newStorageObject("test", "default")), cm)).To(Succeed())
+	cm.Data[resourcesKey] = `{"version":1,"entries":[{"id":"default_a__Con`
+	g.Expect(s.Manager.Client().Update(ctx, cm)).To(Succeed())
+
+	err := s.GetInventory(ctx, NewInventory("test", "default"))
+	g.Expect(errors.Is(err, ErrCorruptInventory)).To(BeTrue())
+
+	s.LenientDecoding = true
+	result := NewInventory("test", "default")
+	err = s.GetInventory(ctx, result)
+	g.Expect(errors.Is(err, ErrCorruptInventory)).To(BeTrue())
+	g.Expect(result.Resources).To(BeEmpty())
+	g.Expect(result.Source).To(Equal("oci://registry/app"))
+
+	result.Resources = inv.Resources
+	g.Expect(s.ApplyInventory(ctx, result, ApplyOptions{})).Error().To(Succeed())
+	result = NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(inv.Resources))
+}
+
+func TestStorage_GetInventories(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		inv := NewInventory(name, "default")
+		inv.Resources = []Resource{{ObjectID: "default_" + name + "__ConfigMap", ObjectVersion: "v1"}}
+		g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	}
+
+	inventories, errs := s.GetInventories(ctx, "default", []string{"a", "missing", "c"})
+	g.Expect(inventories).To(HaveLen(2))
+	g.Expect(inventories["a"].Resources[0].ObjectID).To(Equal("default_a__ConfigMap"))
+	g.Expect(inventories["c"].Resources[0].ObjectID).To(Equal("default_c__ConfigMap"))
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0]).To(MatchError(ErrInventoryNotFound))
+	g.Expect(errs[0].Error()).To(ContainSubstring("default/missing"))
+}
+
+func TestApplyInventory_Labels(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "unrelated",
+		Namespace: "default",
+		Labels:    map[string]string{"team": "platform"},
+	}})
+	s.Labels = map[string]string{"team": "platform"}
+	s.ExtraLabels = map[string]string{"tier": "backend"}
+	s.MaxBytes = 1024
+	s.HistoryLimit = 2
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "v1", nil)
+	for n := 0; n < 100; n++ {
+		inv.Resources = append(inv.Resources, Resource{ObjectID: fmt.Sprintf("default_cm%d__ConfigMap", n), ObjectVersion: "v1"})
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	inv.Revision = "v2"
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	list := &corev1.ConfigMapList{}
+	g.Expect(s.Manager.Client().List(ctx, list, client.InNamespace("default"))).To(Succeed())
+	g.Expect(len(list.Items)).To(BeNumerically(">", 3))
+	for _, cm := range list.Items {
+		g.Expect(cm.GetLabels()).To(Equal(s.Labels))
+	}
+
+	result := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, result)).To(Succeed())
+	g.Expect(result.Resources).To(Equal(sortResources(inv.Resources)))
+	g.Expect(result.Metadata).To(BeEmpty())
+
+	inventories, err := s.ListInventoriesMeta(ctx, "default")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inventories).To(HaveLen(1))
+	g.Expect(inventories[0].Name).To(Equal("test"))
+
+	history, err := s.ListHistory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(1))
+
+	g.Expect(s.DeleteInventory(ctx, inv)).To(Succeed())
+	g.Expect(s.Manager.Client().List(ctx, list, client.InNamespace("default"))).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].Name).To(Equal("unrelated"))
+
+	s.Labels = map[string]string{}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(MatchError(ContainSubstring("at least one label")))
+	g.Expect(s.ListInventories(ctx, "")).Error().To(MatchError(ContainSubstring("at least one label")))
+	g.Expect(s.ListInventoriesMeta(ctx, "")).Error().To(MatchError(ContainSubstring("at least one label")))
+}
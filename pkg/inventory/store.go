@@ -0,0 +1,41 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Store reads and writes inventories, it's implemented by Storage
+// and by the in-memory fake in the inventorytest package.
+type Store interface {
+	// ApplyInventory creates or updates the given inventory.
+	ApplyInventory(ctx context.Context, i *Inventory, opts ApplyOptions) (*ApplyResult, error)
+
+	// GetInventory populates the given inventory from the store.
+	GetInventory(ctx context.Context, i *Inventory) error
+
+	// DeleteInventory removes the given inventory from the store.
+	DeleteInventory(ctx context.Context, i *Inventory) error
+
+	// GetInventoryStaleObjects returns the objects of the stored inventory missing from the given one.
+	GetInventoryStaleObjects(ctx context.Context, i *Inventory, opts PruneOptions) ([]*unstructured.Unstructured, error)
+}
+
+var _ Store = &Storage{}
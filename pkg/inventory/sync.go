@@ -0,0 +1,155 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SyncMetadataOptions contains options for SyncMetadataFromObjects.
+type SyncMetadataOptions struct {
+	// SampleSize is the maximum number of tracked objects inspected, zero inspects all of them.
+	SampleSize int
+
+	// WriteBack updates the stored inventory source and revision to match the tracked objects,
+	// instead of returning an error matching ErrMetadataDrift.
+	WriteBack bool
+}
+
+// SourceAnnotations returns the non-empty source and revision annotations of the given inventory,
+// set on the tracked objects when ReconcileOptions.SourceAnnotations is enabled.
+func (s *Storage) SourceAnnotations(i *Inventory) map[string]string {
+	annotations := make(map[string]string)
+	if i.Source != "" {
+		annotations[s.Owner.Group+"/source"] = i.Source
+	}
+	if i.Revision != "" {
+		annotations[s.Owner.Group+"/revision"] = i.Revision
+	}
+	return annotations
+}
+
+// SetSourceAnnotations adds the source and revision annotations of the given inventory to the objects.
+func (s *Storage) SetSourceAnnotations(objects []*unstructured.Unstructured, i *Inventory) {
+	for _, obj := range objects {
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		for k, v := range s.SourceAnnotations(i) {
+			annotations[k] = v
+		}
+		obj.SetAnnotations(annotations)
+	}
+}
+
+// SyncMetadataFromObjects compares the source and revision of the stored inventory with the
+// '<group>/source' and '<group>/revision' annotations of its tracked objects, as set by Reconcile
+// with SourceAnnotations enabled. The objects that don't exist or don't carry the annotations
+// are skipped, and when the objects disagree, the values found on
+// most of them are used. On drift, the stored inventory is either updated or an error matching
+// ErrMetadataDrift is returned, depending on the options. The given inventory is populated from storage.
+func (s *Storage) SyncMetadataFromObjects(ctx context.Context, i *Inventory, opts SyncMetadataOptions) error {
+	if err := s.GetInventory(ctx, i); err != nil {
+		return err
+	}
+
+	objects, err := i.ListObjects()
+	if err != nil {
+		return err
+	}
+	if opts.SampleSize > 0 && len(objects) > opts.SampleSize {
+		objects = objects[:opts.SampleSize]
+	}
+
+	type sourceRevision struct{ source, revision string }
+	var order []sourceRevision
+	votes := make(map[sourceRevision]int)
+	for _, obj := range objects {
+		existing := &metav1.PartialObjectMetadata{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		err := s.withTimeout(s.Manager.Client()).Get(ctx, client.ObjectKeyFromObject(obj), existing)
+		if err != nil {
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get %s/%s, error: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+		}
+
+		annotations := existing.GetAnnotations()
+		source, hasSource := annotations[s.Owner.Group+"/source"]
+		revision, hasRevision := annotations[s.Owner.Group+"/revision"]
+		if !hasSource && !hasRevision {
+			continue
+		}
+		sr := sourceRevision{source, revision}
+		if votes[sr] == 0 {
+			order = append(order, sr)
+		}
+		votes[sr]++
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	observed := order[0]
+	for _, sr := range order[1:] {
+		if votes[sr] > votes[observed] {
+			observed = sr
+		}
+	}
+	if observed.source == i.Source && observed.revision == i.Revision {
+		return nil
+	}
+
+	if !opts.WriteBack {
+		return newMetadataDriftError(fmt.Errorf(
+			"inventory %s/%s has source '%s' revision '%s', the tracked objects have source '%s' revision '%s'",
+			i.Namespace, i.Name, i.Source, i.Revision, observed.source, observed.revision))
+	}
+
+	obj := s.newStorageObject(i.Name, i.Namespace)
+	err = s.patchAnnotations(ctx, obj, map[string]interface{}{
+		s.Owner.Group + "/source":   nullIfEmpty(observed.source),
+		s.Owner.Group + "/revision": nullIfEmpty(observed.revision),
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return newNotFoundError(err)
+		}
+		return err
+	}
+	i.Source = observed.source
+	i.Revision = observed.revision
+	i.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// nullIfEmpty returns nil for an empty value, so that a merge patch removes the annotation.
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_SyncMetadataFromObjects(t *testing.T) {
+	g := NewWithT(t)
+	newConfigMap := func(name, revision string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Annotations: map[string]string{
+				testOwner.Group + "/source":   "oci://registry/app",
+				testOwner.Group + "/revision": revision,
+			},
+		}}
+	}
+	s := newTestStorage(newConfigMap("a", "v2"), newConfigMap("b", "v2"), newConfigMap("c", "v1"))
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "v1", nil)
+	inv.Resources = []Resource{
+		{ObjectID: "default_a__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_b__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_c__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_missing__ConfigMap", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	err := s.SyncMetadataFromObjects(ctx, NewInventory("test", "default"), SyncMetadataOptions{})
+	g.Expect(errors.Is(err, ErrMetadataDrift)).To(BeTrue())
+
+	g.Expect(s.SyncMetadataFromObjects(ctx, NewInventory("test", "default"), SyncMetadataOptions{
+		SampleSize: 1,
+	})).To(MatchError(ErrMetadataDrift))
+
+	synced := NewInventory("test", "default")
+	g.Expect(s.SyncMetadataFromObjects(ctx, synced, SyncMetadataOptions{WriteBack: true})).To(Succeed())
+	g.Expect(synced.Revision).To(Equal("v2"))
+
+	stored := NewInventory("test", "default")
+	g.Expect(s.GetInventory(ctx, stored)).To(Succeed())
+	g.Expect(stored.Source).To(Equal("oci://registry/app"))
+	g.Expect(stored.Revision).To(Equal("v2"))
+	g.Expect(s.SyncMetadataFromObjects(ctx, stored, SyncMetadataOptions{})).To(Succeed())
+}
+
+func TestStorage_SyncMetadataFromReconcile(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage()
+	ctx := context.Background()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	obj.SetName("a")
+	obj.SetNamespace("default")
+
+	inv := NewInventory("test", "default")
+	inv.SetSource("oci://registry/app", "v1", nil)
+	_, err := s.Reconcile(ctx, inv, []*unstructured.Unstructured{obj}, ReconcileOptions{SourceAnnotations: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(s.SyncMetadataFromObjects(ctx, NewInventory("test", "default"), SyncMetadataOptions{})).To(Succeed())
+
+	inv.SetSource("oci://registry/app", "v2", nil)
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+	err = s.SyncMetadataFromObjects(ctx, NewInventory("test", "default"), SyncMetadataOptions{})
+	g.Expect(err).To(MatchError(ErrMetadataDrift))
+	g.Expect(err.Error()).To(ContainSubstring("the tracked objects have source 'oci://registry/app' revision 'v1'"))
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// VerifyInventory returns the objects recorded in the stored inventory that no longer exist
+// in the cluster, e.g. objects deleted out-of-band. The lookups are made in parallel
+// using the resource manager client.
+func (s *Storage) VerifyInventory(ctx context.Context, i *Inventory) ([]*unstructured.Unstructured, error) {
+	stored := NewInventory(i.Name, i.Namespace)
+	if err := s.GetInventory(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	objects, err := stored.ListObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]bool, len(objects))
+	err = s.forEach(ctx, len(objects), func(ctx context.Context, n int) error {
+		var err error
+		exists[n], err = s.objectExists(ctx, objects[n])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]*unstructured.Unstructured, 0)
+	for n, obj := range objects {
+		if !exists[n] {
+			missing = append(missing, obj)
+		}
+	}
+	sort.Sort(ssa.SortableUnstructureds(missing))
+	return missing, nil
+}
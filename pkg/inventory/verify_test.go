@@ -0,0 +1,55 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestVerifyInventory(t *testing.T) {
+	g := NewWithT(t)
+	s := newTestStorage(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default"}})
+	s.Concurrency = 2
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{
+		{ObjectID: "default_live__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_gone__ConfigMap", ObjectVersion: "v1"},
+		{ObjectID: "default_app_example.com_Unknown", ObjectVersion: "v1"},
+	}
+	g.Expect(s.ApplyInventory(ctx, inv, ApplyOptions{})).Error().To(Succeed())
+
+	missing, err := s.VerifyInventory(ctx, inv)
+	g.Expect(err).ToNot(HaveOccurred())
+	var names []string
+	for _, obj := range missing {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(ConsistOf("gone", "app"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.VerifyInventory(cancelled, inv)
+	g.Expect(err).To(HaveOccurred())
+}
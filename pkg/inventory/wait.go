@@ -0,0 +1,64 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+const readyPollInterval = 2 * time.Second
+
+// ProgressFunc reports the number of processed items out of the total,
+// e.g. the ready objects at the end of a wait.
+type ProgressFunc func(current, total int)
+
+// WaitForReady waits until all the objects of the given inventory are ready according to kstatus,
+// or until the timeout expires in which case the returned error lists the objects that aren't ready.
+// The objects are polled with the status poller of the resource manager.
+// The optional progress function is called with the ready objects once the wait succeeds.
+func (s *Storage) WaitForReady(ctx context.Context, i *Inventory, timeout time.Duration, progress ProgressFunc) error {
+	objects, err := i.ListObjects()
+	if err != nil {
+		return err
+	}
+	set := object.UnstructuredSetToObjMetadataSet(objects)
+
+	// the resource manager doesn't take a context, on cancellation the poller stops at the timeout
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Manager.WaitForSet(set, ssa.WaitOptions{Interval: readyPollInterval, Timeout: timeout})
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("waiting for the objects of inventory %s/%s to be ready failed, error: %w", i.Namespace, i.Name, err)
+		}
+	}
+
+	if progress != nil {
+		progress(len(objects), len(objects))
+	}
+	return nil
+}
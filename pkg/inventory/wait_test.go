@@ -0,0 +1,72 @@
+/*
+Copyright 2021 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_WaitForReady(t *testing.T) {
+	g := NewWithT(t)
+	scheme := apiruntime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}},
+	).Build()
+	poller := polling.NewStatusPoller(kubeClient, mapper, polling.Options{})
+	s := &Storage{
+		Manager: ssa.NewResourceManager(kubeClient, poller, testOwner),
+		Owner:   testOwner,
+	}
+	ctx := context.Background()
+
+	inv := NewInventory("test", "default")
+	inv.Resources = []Resource{{ObjectID: "default_config__ConfigMap", ObjectVersion: "v1"}}
+
+	var ready, total int
+	progress := func(r, t int) { ready, total = r, t }
+	g.Expect(s.WaitForReady(ctx, inv, time.Second, progress)).To(Succeed())
+	g.Expect(ready).To(Equal(1))
+	g.Expect(total).To(Equal(1))
+
+	inv.Resources = append(inv.Resources, Resource{ObjectID: "default_missing__ConfigMap", ObjectVersion: "v1"})
+	ready, total = 0, 0
+	err := s.WaitForReady(ctx, inv, 100*time.Millisecond, progress)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("ConfigMap/default/missing"))
+	g.Expect(err.Error()).ToNot(ContainSubstring("ConfigMap/default/config"))
+	g.Expect(ready).To(BeZero())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	g.Expect(s.WaitForReady(cancelled, inv, time.Second, nil)).To(MatchError(context.Canceled))
+}